@@ -93,7 +93,8 @@ func (s *ActivityLogWriter) Write(ctx context.Context, resource string, action s
 			log[k] = v
 		}
 	}
-	if !s.Config.Goroutines {
+	// a session can not be used concurrently, so the log is written synchronously if ctx carries a session
+	if !s.Config.Goroutines || hasSession(ctx) {
 		_, er3 := s.Collection.InsertOne(ctx, log)
 		return er3
 	} else {
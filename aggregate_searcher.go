@@ -0,0 +1,219 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+)
+
+// AggregateSearcher searches by an aggregation: $match by the query of BuildQuery, then Pipeline ($lookup, $unwind, $group...),
+// then the sort, the pagination and the projection. The total is counted by another pipeline.
+type AggregateSearcher struct {
+	Collection *mongo.Collection
+	Pipeline   mongo.Pipeline
+	BuildQuery func(m interface{}) (bson.M, bson.M)
+	// BuildFilter, if set, is used instead of BuildQuery, to return the errors of the query, such as EncryptionMapper.BuildQuery.
+	BuildFilter func(ctx context.Context, m interface{}) (bson.M, bson.M, error)
+	GetSort     func(m interface{}) string
+	BuildSort   func(s string, modelType reflect.Type) bson.M
+	Map         func(ctx context.Context, model interface{}) (interface{}, error)
+	SoftDelete  *SoftDeleteConfig
+	CountMode   CountMode
+}
+
+func NewAggregateSearcherWithSort(db *mongo.Database, collectionName string, pipeline mongo.Pipeline, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...func(context.Context, interface{}) (interface{}, error)) *AggregateSearcher {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(options) > 0 && options[0] != nil {
+		mp = options[0]
+	}
+	collection := db.Collection(collectionName)
+	return &AggregateSearcher{Collection: collection, Pipeline: pipeline, BuildQuery: buildQuery, GetSort: getSort, BuildSort: buildSort, Map: mp}
+}
+func NewAggregateSearcher(db *mongo.Database, collectionName string, pipeline mongo.Pipeline, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) *AggregateSearcher {
+	return NewAggregateSearcherWithSort(db, collectionName, pipeline, buildQuery, getSort, BuildSort, options...)
+}
+func NewSearcherWithPipeline(db *mongo.Database, collectionName string, pipeline mongo.Pipeline, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) *Searcher {
+	s := NewAggregateSearcherWithSort(db, collectionName, pipeline, buildQuery, getSort, BuildSort, options...)
+	return NewSearcher(s.Search)
+}
+
+func (s *AggregateSearcher) Search(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options ...int64) (int64, error) {
+	query, fields, err := s.buildQuery(ctx, m)
+	if err != nil {
+		return 0, err
+	}
+	query = ExcludeDeleted(query, s.SoftDelete)
+
+	modelType := reflect.TypeOf(results).Elem().Elem()
+	sort := s.BuildSort(s.GetSort(m), modelType)
+	var firstPageSize int64
+	if len(options) > 0 && options[0] > 0 {
+		firstPageSize = options[0]
+	}
+	return BuildAggregateSearchResult(ctx, s.Collection, results, query, s.Pipeline, fields, sort, pageIndex, pageSize, firstPageSize, s.CountMode, s.Map)
+}
+
+// BuildAggregateSearchResult loads the page by one pipeline, and counts the total by another one, so that the page is not limited by the size of a document.
+// If stages output one document for each input document ($lookup, $addFields...) and do not change the sort fields,
+// the page is sorted and limited before stages, and the total is counted by the query only.
+func BuildAggregateSearchResult(ctx context.Context, collection *mongo.Collection, results interface{}, query bson.M, stages mongo.Pipeline, fields bson.M, sort bson.M, pageIndex int64, pageSize int64, initPageSize int64, countMode CountMode, opts ...func(context.Context, interface{}) (interface{}, error)) (int64, error) {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(opts) > 0 {
+		mp = opts[0]
+	}
+	pipeline := mongo.Pipeline{}
+	if len(query) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: query}})
+	}
+	keep := keepsDocuments(stages)
+	if keep && !changesFields(stages, sort) {
+		pipeline = append(pipeline, buildPageStages(sort, pageIndex, pageSize, initPageSize)...)
+		pipeline = append(pipeline, stages...)
+	} else {
+		pipeline = append(pipeline, stages...)
+		pipeline = append(pipeline, buildPageStages(sort, pageIndex, pageSize, initPageSize)...)
+	}
+	if len(fields) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: fields}})
+	}
+	cursor, er0 := collection.Aggregate(ctx, pipeline)
+	if er0 != nil {
+		return 0, er0
+	}
+	if er1 := cursor.All(ctx, results); er1 != nil {
+		return 0, er1
+	}
+	var total int64
+	var er2 error
+	if keep || countMode == CountNone {
+		total, er2 = Count(ctx, collection, query, countMode, 0)
+	} else {
+		total, er2 = countAggregate(ctx, collection, query, stages)
+	}
+	if er2 != nil {
+		return 0, er2
+	}
+	if mp == nil {
+		return total, nil
+	}
+	_, er3 := MapModels(ctx, results, mp)
+	return total, er3
+}
+
+func buildPageStages(sort bson.M, pageIndex int64, pageSize int64, initPageSize int64) mongo.Pipeline {
+	stages := mongo.Pipeline{}
+	if len(sort) > 0 {
+		stages = append(stages, bson.D{{Key: "$sort", Value: sort}})
+	}
+	skip, limit := GetSkipAndLimit(pageIndex, pageSize, initPageSize)
+	if skip > 0 {
+		stages = append(stages, bson.D{{Key: "$skip", Value: skip}})
+	}
+	if limit > 0 {
+		stages = append(stages, bson.D{{Key: "$limit", Value: limit}})
+	}
+	return stages
+}
+
+func countAggregate(ctx context.Context, collection *mongo.Collection, query bson.M, stages mongo.Pipeline) (int64, error) {
+	pipeline := mongo.Pipeline{}
+	if len(query) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: query}})
+	}
+	pipeline = append(pipeline, stages...)
+	pipeline = append(pipeline, bson.D{{Key: "$count", Value: "count"}})
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var totals []struct {
+		Count int64 `bson:"count"`
+	}
+	if er1 := cursor.All(ctx, &totals); er1 != nil || len(totals) == 0 {
+		return 0, er1
+	}
+	return totals[0].Count, nil
+}
+
+// documentStages output one document for each input document, in the same order.
+var documentStages = map[string]bool{"$lookup": true, "$addFields": true, "$set": true, "$project": true, "$unset": true, "$replaceRoot": true, "$replaceWith": true}
+
+func keepsDocuments(stages mongo.Pipeline) bool {
+	for _, stage := range stages {
+		if len(stage) != 1 || !documentStages[stage[0].Key] {
+			return false
+		}
+	}
+	return true
+}
+
+// changesFields returns true if stages can change the values of the sort fields, or if their changed fields are unknown.
+func changesFields(stages mongo.Pipeline, sort bson.M) bool {
+	for _, stage := range stages {
+		changed, ok := stageFields(stage[0])
+		if !ok {
+			return true
+		}
+		for _, field := range changed {
+			for key := range sort {
+				if field == key || strings.HasPrefix(key, field+".") || strings.HasPrefix(field, key+".") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stageFields returns the fields, which are set or removed by a $lookup, $addFields, $set, $project or $unset stage.
+func stageFields(stage bson.E) ([]string, bool) {
+	switch stage.Key {
+	case "$replaceRoot", "$replaceWith":
+		return nil, false
+	case "$unset":
+		switch v := stage.Value.(type) {
+		case string:
+			return []string{v}, true
+		case []string:
+			return v, true
+		case bson.A:
+			fields := make([]string, 0, len(v))
+			for _, f := range v {
+				s, ok := f.(string)
+				if !ok {
+					return nil, false
+				}
+				fields = append(fields, s)
+			}
+			return fields, true
+		}
+		return nil, false
+	}
+	raw, err := bson.Marshal(stage.Value)
+	if err != nil {
+		return nil, false
+	}
+	if stage.Key == "$lookup" {
+		as, ok := bson.Raw(raw).Lookup("as").StringValueOK()
+		return []string{as}, ok
+	}
+	elements, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return nil, false
+	}
+	fields := make([]string, len(elements))
+	for i, e := range elements {
+		fields[i] = e.Key()
+	}
+	return fields, true
+}
+
+func (s *AggregateSearcher) buildQuery(ctx context.Context, m interface{}) (bson.M, bson.M, error) {
+	if s.BuildFilter != nil {
+		return s.BuildFilter(ctx, m)
+	}
+	query, fields := s.BuildQuery(m)
+	return query, fields, nil
+}
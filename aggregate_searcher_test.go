@@ -0,0 +1,99 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+)
+
+type aggregateItem struct {
+	Id   string `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func stageNames(mt *mtest.T, command bson.Raw) []string {
+	stages, _ := command.Lookup("pipeline").Array().Values()
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		elements, err := stage.Document().Elements()
+		if err != nil || len(elements) != 1 {
+			mt.Fatalf("invalid stage: %s", stage)
+		}
+		names[i] = elements[0].Key()
+	}
+	return names
+}
+
+func TestBuildAggregateSearchResult(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ns := "db.items"
+	item := bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "a"}}
+
+	mt.Run("page before lookup", func(mt *mtest.T) {
+		lookup := mongo.Pipeline{{{Key: "$lookup", Value: bson.M{"from": "orders", "localField": "_id", "foreignField": "itemId", "as": "orders"}}}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, item),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: int32(3)}}),
+		)
+		var items []aggregateItem
+		total, err := BuildAggregateSearchResult(context.Background(), mt.Coll, &items, bson.M{"name": "a"}, lookup, nil, bson.M{"name": 1}, 2, 1, 0, CountExact)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if total != 3 || len(items) != 1 {
+			mt.Fatalf("total: %d, items: %v", total, items)
+		}
+		page := stageNames(mt, mt.GetStartedEvent().Command)
+		if expected := "[$match $sort $skip $limit $lookup]"; fmt.Sprint(page) != expected {
+			mt.Fatalf("page pipeline: %v, expected %s", page, expected)
+		}
+		count := stageNames(mt, mt.GetStartedEvent().Command)
+		if expected := "[$match $group]"; fmt.Sprint(count) != expected {
+			mt.Fatalf("count pipeline: %v, expected %s", count, expected)
+		}
+	})
+
+	mt.Run("page after unwind", func(mt *mtest.T) {
+		unwind := mongo.Pipeline{{{Key: "$unwind", Value: "$tags"}}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, item),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "count", Value: int32(5)}}),
+		)
+		var items []aggregateItem
+		total, err := BuildAggregateSearchResult(context.Background(), mt.Coll, &items, nil, unwind, nil, bson.M{"name": 1}, 1, 1, 0, CountExact)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if total != 5 {
+			mt.Fatalf("total: %d, expected 5", total)
+		}
+		page := stageNames(mt, mt.GetStartedEvent().Command)
+		if expected := "[$unwind $sort $limit]"; fmt.Sprint(page) != expected {
+			mt.Fatalf("page pipeline: %v, expected %s", page, expected)
+		}
+		count := stageNames(mt, mt.GetStartedEvent().Command)
+		if expected := "[$unwind $count]"; fmt.Sprint(count) != expected {
+			mt.Fatalf("count pipeline: %v, expected %s", count, expected)
+		}
+	})
+
+	mt.Run("sort by a changed field", func(mt *mtest.T) {
+		set := mongo.Pipeline{{{Key: "$addFields", Value: bson.D{{Key: "name", Value: "$title"}}}}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, item),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: int32(1)}}),
+		)
+		var items []aggregateItem
+		if _, err := BuildAggregateSearchResult(context.Background(), mt.Coll, &items, nil, set, nil, bson.M{"name": 1}, 1, 1, 0, CountExact); err != nil {
+			mt.Fatal(err)
+		}
+		page := stageNames(mt, mt.GetStartedEvent().Command)
+		if expected := "[$addFields $sort $limit]"; fmt.Sprint(page) != expected {
+			mt.Fatalf("page pipeline: %v, expected %s", page, expected)
+		}
+	})
+}
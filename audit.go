@@ -0,0 +1,211 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type AuditConfig struct {
+	User      string `mapstructure:"user" json:"user,omitempty" gorm:"column:user" bson:"user,omitempty" dynamodbav:"user,omitempty" firestore:"user,omitempty"`
+	CreatedBy string `mapstructure:"created_by" json:"createdBy,omitempty" gorm:"column:createdby" bson:"createdBy,omitempty" dynamodbav:"createdBy,omitempty" firestore:"createdBy,omitempty"`
+	CreatedAt string `mapstructure:"created_at" json:"createdAt,omitempty" gorm:"column:createdat" bson:"createdAt,omitempty" dynamodbav:"createdAt,omitempty" firestore:"createdAt,omitempty"`
+	UpdatedBy string `mapstructure:"updated_by" json:"updatedBy,omitempty" gorm:"column:updatedby" bson:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty" firestore:"updatedBy,omitempty"`
+	UpdatedAt string `mapstructure:"updated_at" json:"updatedAt,omitempty" gorm:"column:updatedat" bson:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty" firestore:"updatedAt,omitempty"`
+}
+
+// Auditor stamps the audit fields of a model.
+// The fields are the struct fields named in AuditConfig, or the fields tagged with
+// audit:"createdBy", audit:"createdAt", audit:"updatedBy" or audit:"updatedAt".
+// The user is read from the context key AuditConfig.User, the same key as ActivityLogConfig.User.
+type Auditor struct {
+	Config AuditConfig
+}
+
+type auditFields struct {
+	createdBy int
+	createdAt int
+	updatedBy int
+	updatedAt int
+}
+
+func NewAuditor(c AuditConfig) *Auditor {
+	return &Auditor{Config: c}
+}
+
+func (a *Auditor) fields(modelType reflect.Type) auditFields {
+	return auditFields{
+		createdBy: findAuditField(modelType, a.Config.CreatedBy, "createdBy"),
+		createdAt: findAuditField(modelType, a.Config.CreatedAt, "createdAt"),
+		updatedBy: findAuditField(modelType, a.Config.UpdatedBy, "updatedBy"),
+		updatedAt: findAuditField(modelType, a.Config.UpdatedAt, "updatedAt"),
+	}
+}
+
+func findAuditField(modelType reflect.Type, fieldName string, tag string) int {
+	if len(fieldName) > 0 {
+		return FindFieldIndex(modelType, fieldName)
+	}
+	numField := modelType.NumField()
+	for i := 0; i < numField; i++ {
+		if t, ok := modelType.Field(i).Tag.Lookup("audit"); ok && t == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+// Create stamps all audit fields, for Insert.
+func (a *Auditor) Create(ctx context.Context, model interface{}) {
+	a.stamp(ctx, reflect.ValueOf(model), true, true)
+}
+
+// Update stamps updatedBy and updatedAt, for Update.
+func (a *Auditor) Update(ctx context.Context, model interface{}) {
+	a.stamp(ctx, reflect.ValueOf(model), false, false)
+}
+
+// Save stamps updatedBy and updatedAt, and createdBy and createdAt if they are empty, for Save (upsert).
+// If the document exists, createdBy and createdAt are kept by the upsert functions, see CreatedFields.
+func (a *Auditor) Save(ctx context.Context, model interface{}) {
+	a.stamp(ctx, reflect.ValueOf(model), true, false)
+}
+
+// CreatedFields returns the bson names of createdBy and createdAt of the model, which must not be overwritten when a document is updated or saved again.
+// Pass them to UpdateOne, UpdateByIdAndVersion, UpdateMany, UpsertOne, UpsertOneWithVersion or UpsertMany.
+func (a *Auditor) CreatedFields(model interface{}) []string {
+	if a == nil || model == nil {
+		return nil
+	}
+	modelType := reflect.TypeOf(model)
+	for modelType.Kind() == reflect.Ptr || modelType.Kind() == reflect.Slice {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct {
+		return nil
+	}
+	f := a.fields(modelType)
+	fields := make([]string, 0, 2)
+	for _, i := range []int{f.createdBy, f.createdAt} {
+		if i < 0 {
+			continue
+		}
+		name := GetBsonNameByIndex(modelType, i)
+		if len(name) == 0 {
+			name = strings.ToLower(modelType.Field(i).Name)
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+func (a *Auditor) CreateMany(ctx context.Context, models interface{}) {
+	a.stampMany(ctx, models, true, true)
+}
+
+func (a *Auditor) UpdateMany(ctx context.Context, models interface{}) {
+	a.stampMany(ctx, models, false, false)
+}
+
+func (a *Auditor) SaveMany(ctx context.Context, models interface{}) {
+	a.stampMany(ctx, models, true, false)
+}
+
+// Patch stamps updatedBy and updatedAt, and removes createdBy and createdAt from m, so that Patch never overwrites them.
+// keyOf returns the key of a field in m, usually GetJsonByIndex or GetBsonNameByIndex.
+func (a *Auditor) Patch(ctx context.Context, modelType reflect.Type, m map[string]interface{}, keyOf func(reflect.Type, int) string) {
+	if a == nil || m == nil {
+		return
+	}
+	f := a.fields(modelType)
+	if f.createdBy >= 0 {
+		delete(m, keyOf(modelType, f.createdBy))
+	}
+	if f.createdAt >= 0 {
+		delete(m, keyOf(modelType, f.createdAt))
+	}
+	user := GetString(ctx, a.Config.User)
+	now := time.Now()
+	for _, i := range []int{f.updatedBy, f.updatedAt} {
+		if i < 0 {
+			continue
+		}
+		// the value has the type of the field, as Update stamps it
+		v := reflect.New(modelType.Field(i).Type).Elem()
+		setAuditValue(v, user, now)
+		if !v.IsZero() {
+			m[keyOf(modelType, i)] = v.Interface()
+		}
+	}
+}
+
+func (a *Auditor) PatchMany(ctx context.Context, modelType reflect.Type, models []map[string]interface{}, keyOf func(reflect.Type, int) string) {
+	for _, m := range models {
+		a.Patch(ctx, modelType, m, keyOf)
+	}
+}
+
+func (a *Auditor) stampMany(ctx context.Context, models interface{}, created bool, overwrite bool) {
+	if a == nil {
+		return
+	}
+	vo := reflect.Indirect(reflect.ValueOf(models))
+	if vo.Kind() != reflect.Slice {
+		return
+	}
+	for i := 0; i < vo.Len(); i++ {
+		a.stamp(ctx, vo.Index(i), created, overwrite)
+	}
+}
+
+func (a *Auditor) stamp(ctx context.Context, value reflect.Value, created bool, overwrite bool) {
+	if a == nil {
+		return
+	}
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || !value.CanSet() {
+		return
+	}
+	f := a.fields(value.Type())
+	user := GetString(ctx, a.Config.User)
+	now := time.Now()
+	if created {
+		if f.createdBy >= 0 && (overwrite || value.Field(f.createdBy).IsZero()) {
+			setAuditValue(value.Field(f.createdBy), user, now)
+		}
+		if f.createdAt >= 0 && (overwrite || value.Field(f.createdAt).IsZero()) {
+			setAuditValue(value.Field(f.createdAt), user, now)
+		}
+	}
+	if f.updatedBy >= 0 {
+		setAuditValue(value.Field(f.updatedBy), user, now)
+	}
+	if f.updatedAt >= 0 {
+		setAuditValue(value.Field(f.updatedAt), user, now)
+	}
+}
+
+func setAuditValue(field reflect.Value, user string, now time.Time) {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(user)
+	case *string:
+		field.Set(reflect.ValueOf(&user))
+	case time.Time:
+		field.Set(reflect.ValueOf(now))
+	case *time.Time:
+		field.Set(reflect.ValueOf(&now))
+	case primitive.DateTime:
+		field.Set(reflect.ValueOf(primitive.NewDateTimeFromTime(now)))
+	case *primitive.DateTime:
+		d := primitive.NewDateTimeFromTime(now)
+		field.Set(reflect.ValueOf(&d))
+	}
+}
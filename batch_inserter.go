@@ -2,6 +2,8 @@ package mongo
 
 import (
 	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"reflect"
 )
@@ -9,9 +11,13 @@ import (
 type BatchInserter struct {
 	collection *mongo.Collection
 	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	Auditor    *Auditor
+	Chunk      *ChunkConfig
+	Retry      *RetryPolicy
+	DeadLetter *DeadLetterWriter
 }
 
-func NewBatchInserter(database *mongo.Database, collectionName string, options...func(context.Context, interface{}) (interface{}, error)) *BatchInserter {
+func NewBatchInserter(database *mongo.Database, collectionName string, options ...func(context.Context, interface{}) (interface{}, error)) *BatchInserter {
 	var mp func(context.Context, interface{}) (interface{}, error)
 	if len(options) >= 1 {
 		mp = options[0]
@@ -21,10 +27,30 @@ func NewBatchInserter(database *mongo.Database, collectionName string, options..
 }
 
 func (w *BatchInserter) Write(ctx context.Context, models interface{}) ([]int, []int, error) {
+	if w.DeadLetter != nil {
+		// the dead letters are written once for all chunks, so that they have one batch id and the positions in models
+		statuses, err := WriteChunksWithStatus(ctx, models, w.Chunk, w.Retry, w.write)
+		successIndices, failIndices := SplitStatuses(statuses)
+		if er1 := w.DeadLetter.Write(ctx, models, statuses); er1 != nil {
+			return successIndices, failIndices, deadLetterError(err, er1)
+		}
+		return successIndices, failIndices, err
+	}
+	write := func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return WriteWithRetry(ctx, models, w.Retry, w.write)
+	}
+	if w.Chunk != nil {
+		return WriteChunks(ctx, models, *w.Chunk, write)
+	}
+	return write(ctx, models)
+}
+
+func (w *BatchInserter) write(ctx context.Context, models interface{}) ([]int, []int, error) {
 	successIndices := make([]int, 0)
 	failIndices := make([]int, 0)
 	s := reflect.ValueOf(models)
 	var er1 error
+	w.Auditor.CreateMany(ctx, models)
 	if w.Map != nil {
 		m2, er0 := MapModels(ctx, models, w.Map)
 		if er0 != nil {
@@ -43,7 +69,8 @@ func (w *BatchInserter) Write(ctx context.Context, models interface{}) ([]int, [
 		return successIndices, failIndices, er1
 	}
 
-	if bulkWriteException, ok := er1.(mongo.BulkWriteException); ok {
+	var bulkWriteException mongo.BulkWriteException
+	if errors.As(er1, &bulkWriteException) {
 		for _, writeError := range bulkWriteException.WriteErrors {
 			failIndices = append(failIndices, writeError.Index)
 		}
@@ -60,3 +87,11 @@ func (w *BatchInserter) Write(ctx context.Context, models interface{}) ([]int, [
 	}
 	return successIndices, failIndices, er1
 }
+
+// Replay writes the dead letters of w.DeadLetter matching filter again, and returns the number of the written models.
+func (w *BatchInserter) Replay(ctx context.Context, filter bson.M, modelType reflect.Type) (int, error) {
+	if w.DeadLetter == nil {
+		return 0, errors.New("dead letter is not configured for this writer")
+	}
+	return w.DeadLetter.Replay(ctx, filter, modelType, w.Write)
+}
@@ -2,7 +2,10 @@ package mongo
 
 import (
 	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
 )
 
@@ -11,6 +14,12 @@ type BatchPatcher struct {
 	IdName     string
 	modelType  reflect.Type
 	modelsType reflect.Type
+	Auditor    *Auditor
+	Chunk      *ChunkConfig
+	Retry      *RetryPolicy
+	DeadLetter *DeadLetterWriter
+	// Unordered writes all models, even if some of them fail. By default, the bulk write stops at the first error, and the next models fail too.
+	Unordered bool
 }
 
 func NewBatchPatcherWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string) *BatchPatcher {
@@ -28,38 +37,48 @@ func NewBatchPatcher(database *mongo.Database, collectionName string, modelType
 func CreateMongoBatchPatcherIdName(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string) *BatchPatcher {
 	modelsType := reflect.Zero(reflect.SliceOf(modelType)).Type()
 	collection := database.Collection(collectionName)
-	return &BatchPatcher{collection, fieldName, modelType, modelsType}
+	return &BatchPatcher{collection: collection, IdName: fieldName, modelType: modelType, modelsType: modelsType}
 }
 
 func (w *BatchPatcher) Write(ctx context.Context, models []map[string]interface{}) ([]int, []int, error) {
+	patch := func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return w.write(ctx, models.([]map[string]interface{}))
+	}
+	if w.DeadLetter != nil {
+		// the dead letters are written once for all chunks, so that they have one batch id and the positions in models
+		statuses, err := WriteChunksWithStatus(ctx, models, w.Chunk, w.Retry, patch)
+		successIndices, failIndices := SplitStatuses(statuses)
+		if er1 := w.DeadLetter.Write(ctx, models, statuses); er1 != nil {
+			return successIndices, failIndices, deadLetterError(err, er1)
+		}
+		return successIndices, failIndices, err
+	}
+	write := func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return WriteWithRetry(ctx, models, w.Retry, patch)
+	}
+	if w.Chunk != nil {
+		return WriteChunks(ctx, models, *w.Chunk, write)
+	}
+	return write(ctx, models)
+}
+
+func (w *BatchPatcher) write(ctx context.Context, models []map[string]interface{}) ([]int, []int, error) {
 	successIndices := make([]int, 0)
 	failIndices := make([]int, 0)
 
+	w.Auditor.PatchMany(ctx, w.modelType, models, GetBsonNameByIndex)
 	s := reflect.ValueOf(models)
-	_, err := PatchMaps(ctx, w.collection, models, w.IdName)
-
-	if err == nil {
-		// Return full success
-		for i := 0; i < s.Len(); i++ {
-			successIndices = append(successIndices, i)
-		}
-		return successIndices, failIndices, err
-	}
+	_, err := PatchMapsWithOptions(ctx, w.collection, models, w.IdName, options.BulkWrite().SetOrdered(!w.Unordered))
+	successIndices, failIndices = BulkWriteIndices(s.Len(), err, !w.Unordered)
+	return successIndices, failIndices, err
+}
 
-	if bulkWriteException, ok := err.(mongo.BulkWriteException); ok {
-		for _, writeError := range bulkWriteException.WriteErrors {
-			failIndices = append(failIndices, writeError.Index)
-		}
-		for i := 0; i < s.Len(); i++ {
-			if !InArray(i, failIndices) {
-				successIndices = append(successIndices, i)
-			}
-		}
-	} else {
-		// Return full fail
-		for i := 0; i < s.Len(); i++ {
-			failIndices = append(failIndices, i)
-		}
+// Replay writes the dead letters of w.DeadLetter matching filter again, and returns the number of the written models.
+func (w *BatchPatcher) Replay(ctx context.Context, filter bson.M) (int, error) {
+	if w.DeadLetter == nil {
+		return 0, errors.New("dead letter is not configured for this writer")
 	}
-	return successIndices, failIndices, err
+	return w.DeadLetter.Replay(ctx, filter, reflect.TypeOf(map[string]interface{}{}), func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return w.Write(ctx, models.([]map[string]interface{}))
+	})
 }
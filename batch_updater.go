@@ -3,18 +3,31 @@ package mongo
 import (
 	"context"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
 )
 
 type BatchUpdater struct {
-	collection *mongo.Collection
-	IdName     string
-	modelType  reflect.Type
-	modelsType reflect.Type
-	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	collection   *mongo.Collection
+	IdName       string
+	versionIndex int
+	modelType    reflect.Type
+	modelsType   reflect.Type
+	Map          func(ctx context.Context, model interface{}) (interface{}, error)
+	Auditor      *Auditor
+	Chunk        *ChunkConfig
+	Retry        *RetryPolicy
+	// Unordered writes all models, even if some of them fail. By default, the bulk write stops at the first error, and the next models fail too.
+	Unordered bool
 }
 
-func NewBatchUpdaterWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options...func(context.Context, interface{}) (interface{}, error)) *BatchUpdater {
+func NewBatchUpdaterWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options ...func(context.Context, interface{}) (interface{}, error)) *BatchUpdater {
+	return NewBatchUpdaterWithVersion(database, collectionName, modelType, fieldName, "", options...)
+}
+
+// NewBatchUpdaterWithVersion creates a BatchUpdater, which updates the models by id and version.
+// The models, which are not updated because of ErrVersionConflict or ErrNotFound, are returned as failed indices.
+func NewBatchUpdaterWithVersion(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, versionField string, options ...func(context.Context, interface{}) (interface{}, error)) *BatchUpdater {
 	if len(fieldName) == 0 {
 		_, idName, _ := FindIdField(modelType)
 		fieldName = idName
@@ -24,52 +37,59 @@ func NewBatchUpdaterWithId(database *mongo.Database, collectionName string, mode
 		mp = options[0]
 	}
 	modelsType := reflect.Zero(reflect.SliceOf(modelType)).Type()
+	versionIndex := -1
+	if len(versionField) > 0 {
+		versionIndex = FindFieldIndex(modelType, versionField)
+	}
 	collection := database.Collection(collectionName)
-	return &BatchUpdater{collection, fieldName, modelType, modelsType, mp}
+	return &BatchUpdater{collection: collection, IdName: fieldName, versionIndex: versionIndex, modelType: modelType, modelsType: modelsType, Map: mp}
 }
 
-func NewBatchUpdater(database *mongo.Database, collectionName string, modelType reflect.Type, options...func(context.Context, interface{}) (interface{}, error)) *BatchUpdater {
+func NewBatchUpdater(database *mongo.Database, collectionName string, modelType reflect.Type, options ...func(context.Context, interface{}) (interface{}, error)) *BatchUpdater {
 	return NewBatchUpdaterWithId(database, collectionName, modelType, "", options...)
 }
 
 func (w *BatchUpdater) Write(ctx context.Context, models interface{}) ([]int, []int, error) {
+	write := func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return WriteWithRetry(ctx, models, w.Retry, w.write)
+	}
+	if w.Chunk != nil {
+		return WriteChunks(ctx, models, *w.Chunk, write)
+	}
+	return write(ctx, models)
+}
+
+func (w *BatchUpdater) write(ctx context.Context, models interface{}) ([]int, []int, error) {
 	successIndices := make([]int, 0)
 	failIndices := make([]int, 0)
 
 	s := reflect.ValueOf(models)
 	var err error
+	w.Auditor.UpdateMany(ctx, models)
+	m2 := models
 	if w.Map != nil {
-		m2, er0 := MapModels(ctx, models, w.Map)
+		m3, er0 := MapModels(ctx, models, w.Map)
 		if er0 != nil {
 			return successIndices, failIndices, er0
 		}
-		_, err = UpdateMany(ctx, w.collection, m2, w.IdName)
-	} else {
-		_, err = UpdateMany(ctx, w.collection, models, w.IdName)
-	}
-
-	if err == nil {
-		// Return full success
-		for i := 0; i < s.Len(); i++ {
-			successIndices = append(successIndices, i)
-		}
-		return successIndices, failIndices, err
+		m2 = m3
 	}
-
-	if bulkWriteException, ok := err.(mongo.BulkWriteException); ok {
-		for _, writeError := range bulkWriteException.WriteErrors {
-			failIndices = append(failIndices, writeError.Index)
-		}
-		for i := 0; i < s.Len(); i++ {
-			if !InArray(i, failIndices) {
-				successIndices = append(successIndices, i)
+	if w.versionIndex >= 0 {
+		var fails []int
+		_, fails, err = UpdateManyWithVersionAndOptions(ctx, w.collection, m2, w.IdName, w.versionIndex, options.BulkWrite().SetOrdered(!w.Unordered), w.Auditor.CreatedFields(models)...)
+		if err != nil {
+			for i := 0; i < s.Len(); i++ {
+				if InArray(i, fails) {
+					failIndices = append(failIndices, i)
+				} else {
+					successIndices = append(successIndices, i)
+				}
 			}
+			return successIndices, failIndices, err
 		}
 	} else {
-		// Return full fail
-		for i := 0; i < s.Len(); i++ {
-			failIndices = append(failIndices, i)
-		}
+		_, err = UpdateManyWithOptions(ctx, w.collection, m2, w.IdName, options.BulkWrite().SetOrdered(!w.Unordered), w.Auditor.CreatedFields(models)...)
 	}
+	successIndices, failIndices = BulkWriteIndices(s.Len(), err, !w.Unordered)
 	return successIndices, failIndices, err
 }
@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
 )
 
@@ -10,9 +11,14 @@ type BatchWriter struct {
 	collection *mongo.Collection
 	IdName     string
 	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	Auditor    *Auditor
+	Chunk      *ChunkConfig
+	Retry      *RetryPolicy
+	// Unordered writes all models, even if some of them fail. By default, the bulk write stops at the first error, and the next models fail too.
+	Unordered bool
 }
 
-func NewBatchWriterWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options...func(context.Context, interface{}) (interface{}, error)) *BatchWriter {
+func NewBatchWriterWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options ...func(context.Context, interface{}) (interface{}, error)) *BatchWriter {
 	var mp func(context.Context, interface{}) (interface{}, error)
 	if len(options) >= 1 {
 		mp = options[0]
@@ -22,49 +28,37 @@ func NewBatchWriterWithId(database *mongo.Database, collectionName string, model
 		fieldName = idName
 	}
 	collection := database.Collection(collectionName)
-	return &BatchWriter{collection, fieldName, mp}
+	return &BatchWriter{collection: collection, IdName: fieldName, Map: mp}
 }
-func NewBatchWriter(database *mongo.Database, collectionName string, modelType reflect.Type, options...func(context.Context, interface{}) (interface{}, error)) *BatchWriter {
+func NewBatchWriter(database *mongo.Database, collectionName string, modelType reflect.Type, options ...func(context.Context, interface{}) (interface{}, error)) *BatchWriter {
 	return NewBatchWriterWithId(database, collectionName, modelType, "", options...)
 }
 func (w *BatchWriter) Write(ctx context.Context, models interface{}) ([]int, []int, error) {
+	write := func(ctx context.Context, models interface{}) ([]int, []int, error) {
+		return WriteWithRetry(ctx, models, w.Retry, w.write)
+	}
+	if w.Chunk != nil {
+		return WriteChunks(ctx, models, *w.Chunk, write)
+	}
+	return write(ctx, models)
+}
+
+func (w *BatchWriter) write(ctx context.Context, models interface{}) ([]int, []int, error) {
 	successIndices := make([]int, 0)
 	failIndices := make([]int, 0)
 
 	s := reflect.ValueOf(models)
 	var err error
+	w.Auditor.SaveMany(ctx, models)
 	if w.Map != nil {
 		m2, er0 := MapModels(ctx, models, w.Map)
 		if er0 != nil {
 			return successIndices, failIndices, er0
 		}
-		_, err = UpsertMany(ctx, w.collection, m2, w.IdName)
+		_, err = UpsertManyWithOptions(ctx, w.collection, m2, w.IdName, options.BulkWrite().SetOrdered(!w.Unordered), w.Auditor.CreatedFields(models)...)
 	} else {
-		_, err = UpsertMany(ctx, w.collection, models, w.IdName)
-	}
-
-	if err == nil {
-		// Return full success
-		for i := 0; i < s.Len(); i++ {
-			successIndices = append(successIndices, i)
-		}
-		return successIndices, failIndices, err
-	}
-
-	if bulkWriteException, ok := err.(mongo.BulkWriteException); ok {
-		for _, writeError := range bulkWriteException.WriteErrors {
-			failIndices = append(failIndices, writeError.Index)
-		}
-		for i := 0; i < s.Len(); i++ {
-			if !InArray(i, failIndices) {
-				successIndices = append(successIndices, i)
-			}
-		}
-	} else {
-		// Return full fail
-		for i := 0; i < s.Len(); i++ {
-			failIndices = append(failIndices, i)
-		}
+		_, err = UpsertManyWithOptions(ctx, w.collection, models, w.IdName, options.BulkWrite().SetOrdered(!w.Unordered), w.Auditor.CreatedFields(models)...)
 	}
+	successIndices, failIndices = BulkWriteIndices(s.Len(), err, !w.Unordered)
 	return successIndices, failIndices, err
 }
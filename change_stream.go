@@ -0,0 +1,173 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"time"
+)
+
+type ChangeEvent struct {
+	OperationType string
+	Collection    string
+	Id            interface{}
+	Model         interface{}
+	UpdatedFields bson.M
+	RemovedFields []string
+	ClusterTime   primitive.Timestamp
+	ResumeToken   bson.Raw
+}
+
+type changeEvent struct {
+	OperationType     string              `bson:"operationType"`
+	Ns                changeNamespace     `bson:"ns"`
+	DocumentKey       bson.M              `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription *updateDescription  `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+type changeNamespace struct {
+	Db   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+type updateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+type ResumeTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewResumeTokenRepository(db *mongo.Database, collectionName string) *ResumeTokenRepository {
+	return &ResumeTokenRepository{collection: db.Collection(collectionName)}
+}
+
+func (r *ResumeTokenRepository) Load(ctx context.Context, id string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	ok, err := FindOneAndDecode(ctx, r.collection, bson.M{"_id": id}, &doc)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (r *ResumeTokenRepository) Save(ctx context.Context, id string, token bson.Raw) error {
+	update := bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+type ChangeStreamSubscriber struct {
+	Database     *mongo.Database
+	Collection   *mongo.Collection
+	Id           string
+	Pipeline     mongo.Pipeline
+	Map          func(ctx context.Context, model interface{}) (interface{}, error)
+	Tokens       *ResumeTokenRepository
+	FullDocument options.FullDocument
+	modelType    reflect.Type
+}
+
+// NewChangeStreamSubscriber watches a collection. id is the key of the resume token in tokenCollection, it must be unique per subscriber.
+func NewChangeStreamSubscriber(db *mongo.Database, collectionName string, modelType reflect.Type, id string, tokenCollection string, pipeline mongo.Pipeline, opts ...func(context.Context, interface{}) (interface{}, error)) *ChangeStreamSubscriber {
+	s := NewDatabaseChangeStreamSubscriber(db, modelType, id, tokenCollection, pipeline, opts...)
+	s.Collection = db.Collection(collectionName)
+	return s
+}
+
+// NewDatabaseChangeStreamSubscriber watches all collections of a database.
+func NewDatabaseChangeStreamSubscriber(db *mongo.Database, modelType reflect.Type, id string, tokenCollection string, pipeline mongo.Pipeline, opts ...func(context.Context, interface{}) (interface{}, error)) *ChangeStreamSubscriber {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(opts) > 0 {
+		mp = opts[0]
+	}
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	return &ChangeStreamSubscriber{
+		Database:     db,
+		Id:           id,
+		Pipeline:     pipeline,
+		Map:          mp,
+		Tokens:       NewResumeTokenRepository(db, tokenCollection),
+		FullDocument: options.UpdateLookup,
+		modelType:    modelType,
+	}
+}
+
+// Subscribe blocks until ctx is done, the stream fails or handle returns an error.
+// The resume token is saved after handle succeeds, so an event is handled at least once across restarts.
+func (s *ChangeStreamSubscriber) Subscribe(ctx context.Context, handle func(ctx context.Context, event *ChangeEvent) error) error {
+	opts := options.ChangeStream().SetFullDocument(s.FullDocument)
+	token, err := s.Tokens.Load(ctx, s.Id)
+	if err != nil {
+		return err
+	}
+	if len(token) > 0 {
+		opts.SetResumeAfter(token)
+	}
+	var stream *mongo.ChangeStream
+	if s.Collection != nil {
+		stream, err = s.Collection.Watch(ctx, s.Pipeline, opts)
+	} else {
+		stream, err = s.Database.Watch(ctx, s.Pipeline, opts)
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+	for stream.Next(ctx) {
+		event, er1 := s.decode(ctx, stream.Current)
+		if er1 != nil {
+			return er1
+		}
+		event.ResumeToken = stream.ResumeToken()
+		if er2 := handle(ctx, event); er2 != nil {
+			return er2
+		}
+		if er3 := s.Tokens.Save(ctx, s.Id, event.ResumeToken); er3 != nil {
+			return er3
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+func (s *ChangeStreamSubscriber) decode(ctx context.Context, raw bson.Raw) (*ChangeEvent, error) {
+	var e changeEvent
+	if err := bson.Unmarshal(raw, &e); err != nil {
+		return nil, err
+	}
+	event := &ChangeEvent{OperationType: e.OperationType, Collection: e.Ns.Coll, ClusterTime: e.ClusterTime}
+	if e.DocumentKey != nil {
+		event.Id = e.DocumentKey["_id"]
+	}
+	if e.UpdateDescription != nil {
+		event.UpdatedFields = e.UpdateDescription.UpdatedFields
+		event.RemovedFields = e.UpdateDescription.RemovedFields
+	}
+	if len(e.FullDocument) > 0 && s.modelType != nil {
+		model := reflect.New(s.modelType).Interface()
+		if err := bson.Unmarshal(e.FullDocument, model); err != nil {
+			return nil, fmt.Errorf("cannot decode the full document of %v: %w", event.Id, err)
+		}
+		event.Model = model
+		if s.Map != nil {
+			m2, err := s.Map(ctx, model)
+			if err != nil {
+				return nil, err
+			}
+			event.Model = m2
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,180 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+const (
+	// MaxChunkSize is the max number of operations of a bulk write, accepted by the server.
+	MaxChunkSize = 100000
+	// MaxChunkBytes is the max size of a message, accepted by the server.
+	MaxChunkBytes = 48000000
+)
+
+// ChunkConfig splits the models of a batch write into chunks, which are written by a bounded number of workers.
+type ChunkConfig struct {
+	// Size is the max number of models of a chunk, MaxChunkSize by default.
+	Size int `mapstructure:"size" json:"size,omitempty" gorm:"column:size" bson:"size,omitempty" dynamodbav:"size,omitempty" firestore:"size,omitempty"`
+	// Bytes is the max size of the encoded models of a chunk. A model, which is bigger than Bytes, is written alone.
+	Bytes int `mapstructure:"bytes" json:"bytes,omitempty" gorm:"column:bytes" bson:"bytes,omitempty" dynamodbav:"bytes,omitempty" firestore:"bytes,omitempty"`
+	// Concurrency is the max number of chunks written at the same time, 1 by default.
+	Concurrency int `mapstructure:"concurrency" json:"concurrency,omitempty" gorm:"column:concurrency" bson:"concurrency,omitempty" dynamodbav:"concurrency,omitempty" firestore:"concurrency,omitempty"`
+}
+
+// Split returns the start and end positions of the chunks of models.
+func (c ChunkConfig) Split(models interface{}) ([][2]int, error) {
+	values := reflect.Indirect(reflect.ValueOf(models))
+	length := values.Len()
+	size := c.Size
+	if size <= 0 || size > MaxChunkSize {
+		size = MaxChunkSize
+	}
+	maxBytes := c.Bytes
+	if maxBytes <= 0 || maxBytes > MaxChunkBytes {
+		maxBytes = MaxChunkBytes
+	}
+	chunks := make([][2]int, 0)
+	start, bytes := 0, 0
+	for i := 0; i < length; i++ {
+		data, err := bson.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		n := len(data)
+		if i > start && (i-start >= size || bytes+n > maxBytes) {
+			chunks = append(chunks, [2]int{start, i})
+			start, bytes = i, 0
+		}
+		bytes += n
+	}
+	if start < length {
+		chunks = append(chunks, [2]int{start, length})
+	}
+	return chunks, nil
+}
+
+// WriteChunks writes the chunks of models by write, and remaps the success and fail indices of each chunk to the positions in models.
+// The errors of the chunks are joined: the duplicate key errors are merged to a *DuplicateKeyErrors, which wraps the merged BulkWriteException,
+// the write errors are merged to a BulkWriteException, else the first error is returned.
+// If ctx carries a session, the chunks are written one by one, because a session cannot be used concurrently.
+func WriteChunks(ctx context.Context, models interface{}, c ChunkConfig, write func(context.Context, interface{}) ([]int, []int, error)) ([]int, []int, error) {
+	chunks, err := c.Split(models)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(chunks) <= 1 {
+		return write(ctx, models)
+	}
+	values := reflect.Indirect(reflect.ValueOf(models))
+	successes := make([][]int, len(chunks))
+	fails := make([][]int, len(chunks))
+	errs := make([]error, len(chunks))
+	runChunks(ctx, chunks, c.Concurrency, func(i int, start int, end int) {
+		successes[i], fails[i], errs[i] = write(ctx, values.Slice(start, end).Interface())
+	})
+
+	successIndices := make([]int, 0)
+	failIndices := make([]int, 0)
+	var firstErr error
+	var duplicates *DuplicateKeyErrors
+	var bulkWriteException *mongo.BulkWriteException
+	for i, chunk := range chunks {
+		for _, k := range successes[i] {
+			successIndices = append(successIndices, chunk[0]+k)
+		}
+		for _, k := range fails[i] {
+			failIndices = append(failIndices, chunk[0]+k)
+		}
+		if errs[i] == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = errs[i]
+		}
+		var e mongo.BulkWriteException
+		if errors.As(errs[i], &e) {
+			if bulkWriteException == nil {
+				bulkWriteException = &mongo.BulkWriteException{WriteConcernError: e.WriteConcernError}
+			}
+			for _, writeError := range e.WriteErrors {
+				writeError.Index = chunk[0] + writeError.Index
+				bulkWriteException.WriteErrors = append(bulkWriteException.WriteErrors, writeError)
+			}
+			bulkWriteException.Labels = append(bulkWriteException.Labels, e.Labels...)
+		}
+		var d *DuplicateKeyErrors
+		if errors.As(errs[i], &d) {
+			if duplicates == nil {
+				duplicates = &DuplicateKeyErrors{}
+			}
+			for _, e := range d.Errors {
+				shifted := *e
+				shifted.Index = chunk[0] + e.Index
+				duplicates.Errors = append(duplicates.Errors, &shifted)
+			}
+		}
+	}
+	sort.Ints(successIndices)
+	sort.Ints(failIndices)
+	// the errors of the chunks have the positions in the chunks, so the write errors are merged with the positions in models
+	var combined error
+	if bulkWriteException != nil {
+		combined = *bulkWriteException
+	}
+	if duplicates != nil {
+		duplicates.err = combined
+		return successIndices, failIndices, duplicates
+	}
+	var e mongo.BulkWriteException
+	if combined != nil && errors.As(firstErr, &e) {
+		return successIndices, failIndices, combined
+	}
+	return successIndices, failIndices, firstErr
+}
+
+// WriteChunksWithStatus writes the chunks of models by write with the retry policy, and returns the status of each model, by the positions in models.
+// If c is nil, models are written in one chunk. The error is a *DuplicateKeyErrors if some models are duplicated, else the first error of the models.
+func WriteChunksWithStatus(ctx context.Context, models interface{}, c *ChunkConfig, p *RetryPolicy, write func(context.Context, interface{}) ([]int, []int, error)) ([]WriteStatus, error) {
+	if c == nil {
+		return p.WriteWithStatus(ctx, models, write)
+	}
+	chunks, err := c.Split(models)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) <= 1 {
+		return p.WriteWithStatus(ctx, models, write)
+	}
+	values := reflect.Indirect(reflect.ValueOf(models))
+	statuses := make([]WriteStatus, values.Len())
+	runChunks(ctx, chunks, c.Concurrency, func(i int, start int, end int) {
+		chunkStatuses, _ := p.WriteWithStatus(ctx, values.Slice(start, end).Interface(), write)
+		copy(statuses[start:end], chunkStatuses)
+	})
+	return statuses, statusError(statuses)
+}
+
+// runChunks calls write for each chunk, by at most concurrency workers. If ctx carries a session, the chunks are written one by one.
+func runChunks(ctx context.Context, chunks [][2]int, concurrency int, write func(i int, start int, end int)) {
+	if concurrency <= 0 || hasSession(ctx) {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, start int, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			write(i, start, end)
+		}(i, chunk[0], chunk[1])
+	}
+	wg.Wait()
+}
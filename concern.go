@@ -0,0 +1,145 @@
+package mongo
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+	"strconv"
+	"time"
+)
+
+func BuildReadPreference(c ReadPreferenceConfig) (*readpref.ReadPref, error) {
+	mode := readpref.PrimaryMode
+	if len(c.Mode) > 0 {
+		m, err := readpref.ModeFromString(c.Mode)
+		if err != nil {
+			return nil, err
+		}
+		mode = m
+	}
+	opts := make([]readpref.Option, 0)
+	if len(c.TagSets) > 0 {
+		opts = append(opts, readpref.WithTagSets(tag.NewTagSetsFromMaps(c.TagSets)...))
+	}
+	if c.MaxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(time.Duration(c.MaxStaleness)*time.Second))
+	}
+	rp, err := readpref.New(mode, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read preference %s: %w", c.Mode, err)
+	}
+	return rp, nil
+}
+
+func BuildReadConcern(level string) (*readconcern.ReadConcern, error) {
+	switch level {
+	case "local", "available", "majority", "linearizable", "snapshot":
+		return readconcern.New(readconcern.Level(level)), nil
+	}
+	return nil, fmt.Errorf("invalid read concern %s", level)
+}
+
+func BuildWriteConcern(c WriteConcernConfig) (*writeconcern.WriteConcern, error) {
+	opts := make([]writeconcern.Option, 0)
+	if c.W == "majority" {
+		opts = append(opts, writeconcern.WMajority())
+	} else if n, err := strconv.Atoi(c.W); err == nil {
+		if n < 0 {
+			return nil, fmt.Errorf("invalid write concern w %s", c.W)
+		}
+		opts = append(opts, writeconcern.W(n))
+	} else if len(c.W) > 0 {
+		opts = append(opts, writeconcern.WTagSet(c.W))
+	}
+	if c.J != nil {
+		opts = append(opts, writeconcern.J(*c.J))
+	}
+	if c.WTimeout > 0 {
+		opts = append(opts, writeconcern.WTimeout(time.Duration(c.WTimeout)*time.Millisecond))
+	}
+	wc := writeconcern.New(opts...)
+	if !wc.IsValid() {
+		return nil, fmt.Errorf("invalid write concern: w %s cannot be used with j", c.W)
+	}
+	return wc, nil
+}
+
+// CloneCollection returns a clone of collection, with the concerns of c. The concerns, which are not set in c, are inherited.
+func CloneCollection(collection *mongo.Collection, c ConcernConfig) (*mongo.Collection, error) {
+	opts := options.Collection()
+	if c.ReadPreference != nil {
+		rp, err := BuildReadPreference(*c.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if len(c.ReadConcern) > 0 {
+		rc, err := BuildReadConcern(c.ReadConcern)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadConcern(rc)
+	}
+	if c.WriteConcern != nil {
+		wc, err := BuildWriteConcern(*c.WriteConcern)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetWriteConcern(wc)
+	}
+	return collection.Clone(opts)
+}
+
+// SetConcerns overrides the concerns of the client for this loader, or the writer which embeds it.
+func (m *Loader) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&m.Collection, c)
+}
+
+func (b *SearchBuilder) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&b.Collection, c)
+}
+
+func (s *AggregateSearcher) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&s.Collection, c)
+}
+
+func (w *Inserter) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *Updater) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *MongoWriter) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *BatchInserter) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *BatchUpdater) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *BatchPatcher) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func (w *BatchWriter) SetConcerns(c ConcernConfig) error {
+	return setConcerns(&w.collection, c)
+}
+
+func setConcerns(collection **mongo.Collection, c ConcernConfig) error {
+	clone, err := CloneCollection(*collection, c)
+	if err == nil {
+		*collection = clone
+	}
+	return err
+}
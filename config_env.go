@@ -0,0 +1,280 @@
+package mongo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const redacted = "******"
+
+// LoadMongoConfig overlays c from the environment variables, see OverlayEnv, then validates it.
+func LoadMongoConfig(c *MongoConfig, prefix string) error {
+	if err := OverlayEnv(c, prefix); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// OverlayEnv sets the fields of c from the environment variables named by prefix and the upper case of the mapstructure tags,
+// joined by underscores: MONGO_URI, MONGO_CREDENTIAL_PASSWORD, MONGO_READ_PREFERENCE_MODE, MONGO_TLS_CA_FILE...
+// If a variable with the suffix _FILE is set, such as MONGO_CREDENTIAL_PASSWORD_FILE, the value is read from this file, such as a mounted secret.
+// The slices are separated by commas, the maps are written as k1=v1,k2=v2, and the tag sets are separated by semicolons.
+// lookup replaces os.LookupEnv, for tests.
+func OverlayEnv(c *MongoConfig, prefix string, lookup ...func(string) (string, bool)) error {
+	lookupEnv := os.LookupEnv
+	if len(lookup) > 0 && lookup[0] != nil {
+		lookupEnv = lookup[0]
+	}
+	_, err := overlayStruct(reflect.ValueOf(c).Elem(), strings.ToUpper(prefix), lookupEnv)
+	return err
+}
+
+func overlayStruct(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) (bool, error) {
+	t := v.Type()
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("mapstructure"), ",")[0]
+		if len(tag) == 0 || tag == "-" {
+			continue
+		}
+		name := strings.ToUpper(tag)
+		if len(prefix) > 0 {
+			name = prefix + "_" + name
+		}
+		field := v.Field(i)
+		ft := field.Type()
+		if ft.Kind() == reflect.Struct || (ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct) {
+			nested := field
+			if ft.Kind() == reflect.Ptr {
+				nested = reflect.New(ft.Elem()).Elem()
+				if !field.IsNil() {
+					nested.Set(field.Elem())
+				}
+			}
+			ok, err := overlayStruct(nested, name, lookupEnv)
+			if err != nil {
+				return changed, err
+			}
+			if ok && ft.Kind() == reflect.Ptr {
+				field.Set(nested.Addr())
+			}
+			changed = changed || ok
+			continue
+		}
+		s, ok, err := lookupValue(name, lookupEnv)
+		if err != nil {
+			return changed, err
+		}
+		if !ok {
+			continue
+		}
+		if err = setEnvValue(field, s); err != nil {
+			return changed, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func lookupValue(name string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	value, ok := lookupEnv(name)
+	file, okFile := lookupEnv(name + "_FILE")
+	if !okFile || len(file) == 0 {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("%s and %s_FILE cannot be set together", name, name)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+func setEnvValue(field reflect.Value, s string) error {
+	if field.Kind() == reflect.Ptr {
+		p := reflect.New(field.Type().Elem())
+		if err := setEnvValue(p.Elem(), s); err != nil {
+			return err
+		}
+		field.Set(p)
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Map:
+		m, err := parseEnvMap(s)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(m))
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Map {
+			sets := make([]map[string]string, 0)
+			for _, set := range strings.Split(s, ";") {
+				m, err := parseEnvMap(set)
+				if err != nil {
+					return err
+				}
+				sets = append(sets, m)
+			}
+			field.Set(reflect.ValueOf(sets))
+			return nil
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("type %s is not supported", field.Type())
+	}
+	return nil
+}
+
+func parseEnvMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); len(pair) == 0 {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s is not a key=value pair", pair)
+		}
+		m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return m, nil
+}
+
+// Validate returns an error if the settings of c conflict.
+func (c MongoConfig) Validate() error {
+	if len(c.Uri) == 0 && len(c.Hosts) == 0 {
+		return errors.New("uri or hosts is required")
+	}
+	if c.Direct != nil && *c.Direct {
+		if len(c.Hosts) > 1 {
+			return errors.New("direct cannot be used with multiple hosts")
+		}
+		if _, hosts, _ := splitUri(c.Uri); strings.Contains(hosts, ",") {
+			return errors.New("direct cannot be used with multiple hosts in the uri")
+		}
+	}
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		return fmt.Errorf("min_pool_size %d is greater than max_pool_size %d", c.MinPoolSize, c.MaxPoolSize)
+	}
+	if c.Credential != nil && len(c.Credential.Username) > 0 {
+		if userInfo, _, _ := splitUri(c.Uri); len(userInfo) > 0 {
+			return errors.New("credential cannot be set in both uri and credential")
+		}
+	}
+	return ValidateCredential(c)
+}
+
+// Redact returns a copy of c, without the password and the secret options of the uri, the credential password and the tls key password.
+func (c MongoConfig) Redact() MongoConfig {
+	r := c
+	r.Uri = redactUri(c.Uri)
+	if c.Credential != nil {
+		cr := *c.Credential
+		if len(cr.Password) > 0 {
+			cr.Password = redacted
+		}
+		r.Credential = &cr
+	}
+	if c.TLS != nil {
+		t := *c.TLS
+		if len(t.KeyPassword) > 0 {
+			t.KeyPassword = redacted
+		}
+		r.TLS = &t
+	}
+	return r
+}
+
+// secretUriOptions are the options of the connection string, in lower case, which can contain a password or a token.
+var secretUriOptions = map[string]bool{
+	"tlscertificatekeyfilepassword":   true,
+	"sslclientcertificatekeypassword": true,
+	"authmechanismproperties":         true,
+	"password":                        true,
+}
+
+func redactUri(uri string) string {
+	userInfo, _, start := splitUri(uri)
+	if i := strings.IndexByte(userInfo, ':'); i >= 0 {
+		uri = uri[:start+i+1] + redacted + uri[start+len(userInfo):]
+	}
+	q := strings.IndexByte(uri, '?')
+	if q < 0 {
+		return uri
+	}
+	params := strings.Split(uri[q+1:], "&")
+	for i, param := range params {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 && secretUriOptions[strings.ToLower(kv[0])] {
+			params[i] = kv[0] + "=" + redacted
+		}
+	}
+	return uri[:q+1] + strings.Join(params, "&")
+}
+
+// splitUri returns the user info and the hosts of a connection string, and the position of the user info.
+// It does not use url.Parse, which rejects the connection strings with multiple hosts.
+func splitUri(uri string) (string, string, int) {
+	start := strings.Index(uri, "://")
+	if start < 0 {
+		return "", "", 0
+	}
+	start += 3
+	authority := uri[start:]
+	if i := strings.IndexAny(authority, "/?"); i >= 0 {
+		authority = authority[:i]
+	}
+	if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+		return authority[:i], authority[i+1:], start
+	}
+	return "", authority, start
+}
+
+// MarshalJSON marshals the redacted config, so the secrets are not logged.
+func (c MongoConfig) MarshalJSON() ([]byte, error) {
+	type config MongoConfig
+	return json.Marshal(config(c.Redact()))
+}
+
+func (c MongoConfig) String() string {
+	data, err := c.MarshalJSON()
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -0,0 +1,14 @@
+package mongo
+
+import "testing"
+
+func TestValidateCredentialInUri(t *testing.T) {
+	c := MongoConfig{Uri: "mongodb://a:b@localhost:27017", Credential: &CredentialConfig{Username: "a", Password: "b"}}
+	if err := c.Validate(); err == nil {
+		t.Fatal("credential in both uri and credential is valid")
+	}
+	c.Uri = "mongodb://localhost:27017"
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"time"
+)
+
+type replayKey struct{}
+
+// DeadLetter is a model, which cannot be written by a batch writer, with the error of the last attempt.
+type DeadLetter struct {
+	Id         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	BatchId    string             `json:"batchId,omitempty" bson:"batchId,omitempty"`
+	Collection string             `json:"collection,omitempty" bson:"collection,omitempty"`
+	Index      int                `json:"index" bson:"index"` // position of the model in the written batch
+	Attempts   int                `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	Code       int                `json:"code,omitempty" bson:"code,omitempty"`
+	Message    string             `json:"message,omitempty" bson:"message,omitempty"`
+	Document   bson.Raw           `json:"document,omitempty" bson:"document,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+}
+
+// DeadLetterWriter diverts the failed models of BatchInserter and BatchPatcher into a dead-letter collection.
+// Source is the collection of the batch writer, so that a dead-letter collection can be shared.
+type DeadLetterWriter struct {
+	Collection      *mongo.Collection
+	Source          string
+	GenerateBatchId func(ctx context.Context) string
+}
+
+func NewDeadLetterWriter(database *mongo.Database, collectionName string, source string, options ...func(context.Context) string) *DeadLetterWriter {
+	var generate func(context.Context) string
+	if len(options) > 0 && options[0] != nil {
+		generate = options[0]
+	}
+	return &DeadLetterWriter{Collection: database.Collection(collectionName), Source: source, GenerateBatchId: generate}
+}
+
+// Write inserts the failed models of a batch, with their errors. The models, which fail during Replay, are not inserted again.
+func (d *DeadLetterWriter) Write(ctx context.Context, models interface{}, statuses []WriteStatus) error {
+	if d == nil || IsReplay(ctx) {
+		return nil
+	}
+	var batchId string
+	if d.GenerateBatchId != nil {
+		batchId = d.GenerateBatchId(ctx)
+	} else {
+		batchId = primitive.NewObjectID().Hex()
+	}
+	values := reflect.Indirect(reflect.ValueOf(models))
+	now := time.Now()
+	letters := make([]interface{}, 0)
+	for i, status := range statuses {
+		if status.Err == nil {
+			continue
+		}
+		doc, err := bson.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		letters = append(letters, DeadLetter{BatchId: batchId, Collection: d.Source, Index: i, Attempts: status.Attempts, Code: ErrorCode(status.Err), Message: status.Err.Error(), Document: doc, CreatedAt: now})
+	}
+	if len(letters) == 0 {
+		return nil
+	}
+	_, err := d.Collection.InsertMany(ctx, letters)
+	return err
+}
+
+// deadLetterError returns the error of a batch write, when the dead letters cannot be written.
+func deadLetterError(err error, deadLetterErr error) error {
+	if err == nil {
+		return fmt.Errorf("cannot write dead letters: %w", deadLetterErr)
+	}
+	return fmt.Errorf("%w; cannot write dead letters: %v", err, deadLetterErr)
+}
+
+// Replay loads the dead letters of Source matching filter, decodes their documents to modelType, and writes them by write, which is usually the Write method of the same batch writer.
+// The dead letters, which are written, are deleted. It returns the number of the written models.
+func (d *DeadLetterWriter) Replay(ctx context.Context, filter bson.M, modelType reflect.Type, write func(context.Context, interface{}) ([]int, []int, error)) (int, error) {
+	query := bson.M{"collection": d.Source}
+	for k, v := range filter {
+		query[k] = v
+	}
+	cursor, err := d.Collection.Find(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	var letters []DeadLetter
+	if err = cursor.All(ctx, &letters); err != nil {
+		return 0, err
+	}
+	if len(letters) == 0 {
+		return 0, nil
+	}
+	models := reflect.MakeSlice(reflect.SliceOf(modelType), 0, len(letters))
+	for _, letter := range letters {
+		model := reflect.New(modelType)
+		if er1 := bson.Unmarshal(letter.Document, model.Interface()); er1 != nil {
+			return 0, fmt.Errorf("cannot decode dead letter %s: %w", letter.Id.Hex(), er1)
+		}
+		models = reflect.Append(models, model.Elem())
+	}
+	successIndices, _, er2 := write(context.WithValue(ctx, replayKey{}, true), models.Interface())
+	if len(successIndices) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(successIndices))
+		for _, i := range successIndices {
+			ids = append(ids, letters[i].Id)
+		}
+		if _, er3 := d.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); er3 != nil {
+			return len(successIndices), er3
+		}
+	}
+	return len(successIndices), er2
+}
+
+// IsReplay returns true if ctx is passed by DeadLetterWriter.Replay.
+func IsReplay(ctx context.Context) bool {
+	v, ok := ctx.Value(replayKey{}).(bool)
+	return ok && v
+}
+
+// ErrorCode returns the server error code of err, 0 if err is not a server error.
+func ErrorCode(err error) int {
+	var duplicateKeyError *DuplicateKeyError
+	if errors.As(err, &duplicateKeyError) {
+		return 11000
+	}
+	var writeError mongo.WriteError
+	if errors.As(err, &writeError) {
+		return writeError.Code
+	}
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		if len(writeException.WriteErrors) > 0 {
+			return writeException.WriteErrors[0].Code
+		}
+		if writeException.WriteConcernError != nil {
+			return writeException.WriteConcernError.Code
+		}
+	}
+	var bulkWriteException mongo.BulkWriteException
+	if errors.As(err, &bulkWriteException) {
+		if len(bulkWriteException.WriteErrors) > 0 {
+			return bulkWriteException.WriteErrors[0].Code
+		}
+		if bulkWriteException.WriteConcernError != nil {
+			return bulkWriteException.WriteConcernError.Code
+		}
+	}
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) {
+		return int(commandError.Code)
+	}
+	return 0
+}
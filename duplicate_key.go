@@ -0,0 +1,251 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+	"strings"
+)
+
+// DuplicateKeyError is returned when a write violates a unique index. It matches ErrDuplicateKey with errors.Is.
+// IndexName and Key are parsed from the server message, for example:
+// E11000 duplicate key error collection: test.users index: email_1 dup key: { email: "a@b.com" }
+type DuplicateKeyError struct {
+	// Index is the position of the model in the batch, 0 for a single write.
+	Index     int
+	IndexName string
+	Key       bson.M
+	Message   string
+	err       error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return e.Message
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.err
+}
+
+// DuplicateKeyErrors is returned by the batch inserts, when some of the models violate a unique index.
+// It unwraps to the mongo.BulkWriteException, which also contains the other write errors, if any.
+type DuplicateKeyErrors struct {
+	Errors []*DuplicateKeyError
+	err    error
+}
+
+func (e *DuplicateKeyErrors) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Message
+	}
+	return fmt.Sprintf("%d duplicate key errors, first: %s", len(e.Errors), e.Errors[0].Message)
+}
+
+func (e *DuplicateKeyErrors) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+func (e *DuplicateKeyErrors) Unwrap() error {
+	return e.err
+}
+
+// Indices returns the positions of the duplicated models in the batch.
+func (e *DuplicateKeyErrors) Indices() []int {
+	indices := make([]int, len(e.Errors))
+	for i, d := range e.Errors {
+		indices[i] = d.Index
+	}
+	return indices
+}
+
+func NewDuplicateKeyError(index int, message string) *DuplicateKeyError {
+	indexName, key := ParseDuplicateKeyMessage(message)
+	return &DuplicateKeyError{Index: index, IndexName: indexName, Key: key, Message: message}
+}
+
+// newWriteDuplicateKeyError prefers the keyValue and keyPattern of the details of the write error, when they are present,
+// to the key parsed from the message.
+func newWriteDuplicateKeyError(e mongo.WriteError) *DuplicateKeyError {
+	indexName, key := parseDuplicateKeyMessage(e.Message)
+	d := &DuplicateKeyError{Index: e.Index, IndexName: indexName, Message: e.Message}
+	if len(e.Details) > 0 {
+		if raw, ok := e.Details.Lookup("keyValue").DocumentOK(); ok {
+			keyValue := bson.M{}
+			if err := bson.Unmarshal(raw, &keyValue); err == nil {
+				d.Key = keyValue
+				return d
+			}
+		}
+		if raw, ok := e.Details.Lookup("keyPattern").DocumentOK(); ok {
+			// the messages of the servers before 4.2 do not have the field names: { : "a@b.com" }
+			if elements, err := raw.Elements(); err == nil && len(elements) == len(key) {
+				for i, element := range elements {
+					if len(key[i].Key) == 0 {
+						key[i].Key = element.Key()
+					}
+				}
+			}
+		}
+	}
+	if key != nil {
+		d.Key = key.Map()
+	}
+	return d
+}
+
+// ToDuplicateKeyError converts the duplicate key errors of a mongo.WriteException or a mongo.BulkWriteException
+// to a *DuplicateKeyError or a *DuplicateKeyErrors. Other errors are returned as they are.
+func ToDuplicateKeyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var writeErrors []mongo.WriteError
+	var bulkWriteException mongo.BulkWriteException
+	var writeException mongo.WriteException
+	if errors.As(err, &bulkWriteException) {
+		for _, e := range bulkWriteException.WriteErrors {
+			writeErrors = append(writeErrors, e.WriteError)
+		}
+	} else if errors.As(err, &writeException) {
+		writeErrors = writeException.WriteErrors
+	} else {
+		return err
+	}
+	duplicates := make([]*DuplicateKeyError, 0)
+	for _, e := range writeErrors {
+		if isDuplicateKeyCode(e.Code) {
+			d := newWriteDuplicateKeyError(e)
+			d.err = err
+			duplicates = append(duplicates, d)
+		}
+	}
+	if len(duplicates) == 0 {
+		return err
+	}
+	if len(bulkWriteException.WriteErrors) == 0 && len(duplicates) == 1 {
+		return duplicates[0]
+	}
+	return &DuplicateKeyErrors{Errors: duplicates, err: err}
+}
+
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
+
+// ParseDuplicateKeyMessage returns the index name and the key of a duplicate key error message.
+func ParseDuplicateKeyMessage(message string) (string, bson.M) {
+	indexName, key := parseDuplicateKeyMessage(message)
+	if key == nil {
+		return indexName, nil
+	}
+	return indexName, key.Map()
+}
+
+func parseDuplicateKeyMessage(message string) (string, bson.D) {
+	var indexName string
+	if i := strings.Index(message, "index: "); i >= 0 {
+		s := message[i+len("index: "):]
+		if j := strings.Index(s, " dup key:"); j >= 0 {
+			indexName = strings.TrimSpace(s[:j])
+		} else if j := strings.IndexByte(s, ' '); j >= 0 {
+			indexName = s[:j]
+		} else {
+			indexName = s
+		}
+	}
+	i := strings.Index(message, "dup key: {")
+	if i < 0 {
+		return indexName, nil
+	}
+	s := message[i+len("dup key: "):]
+	if j := strings.LastIndexByte(s, '}'); j >= 0 {
+		s = s[:j+1]
+	}
+	return indexName, parseKeyDocument(s)
+}
+
+// parseKeyDocument parses a document of a duplicate key message, such as { name: "a", address: { city: "b" } }.
+func parseKeyDocument(s string) bson.D {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	key := bson.D{}
+	for _, pair := range splitTopLevel(s) {
+		k, v := pair, ""
+		if j := strings.Index(pair, ": "); j >= 0 {
+			k, v = pair[:j], pair[j+2:]
+		} else if strings.HasPrefix(pair, ":") {
+			k, v = "", pair[1:]
+		}
+		key = append(key, bson.E{Key: strings.TrimSpace(k), Value: parseKeyValue(strings.TrimSpace(v))})
+	}
+	return key
+}
+
+// splitTopLevel splits s by the commas, which are not inside quotes, brackets or parentheses.
+func splitTopLevel(s string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); len(last) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func parseKeyValue(v string) interface{} {
+	switch {
+	case v == "null":
+		return nil
+	case v == "true":
+		return true
+	case v == "false":
+		return false
+	case strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}"):
+		return parseKeyDocument(v).Map()
+	case strings.HasPrefix(v, `"`):
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+		return strings.Trim(v, `"`)
+	case strings.HasPrefix(v, "ObjectId('") && strings.HasSuffix(v, "')"):
+		if id, err := primitive.ObjectIDFromHex(v[len("ObjectId('") : len(v)-2]); err == nil {
+			return id
+		}
+	case strings.HasPrefix(v, "new Date(") && strings.HasSuffix(v, ")"):
+		if ms, err := strconv.ParseInt(v[len("new Date("):len(v)-1], 10, 64); err == nil {
+			return primitive.DateTime(ms)
+		}
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package mongo
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"testing"
+)
+
+func TestParseDuplicateKeyMessage(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f8d0d55b54764421b7156c9")
+	tests := []struct {
+		name      string
+		message   string
+		indexName string
+		key       bson.M
+	}{
+		{
+			name:      "quoted comma",
+			message:   `E11000 duplicate key error collection: test.users index: email_1 dup key: { email: "a,b@c.com" }`,
+			indexName: "email_1",
+			key:       bson.M{"email": "a,b@c.com"},
+		},
+		{
+			name:      "object id",
+			message:   `E11000 duplicate key error collection: test.users index: _id_ dup key: { _id: ObjectId('5f8d0d55b54764421b7156c9') }`,
+			indexName: "_id_",
+			key:       bson.M{"_id": id},
+		},
+		{
+			name:      "compound key",
+			message:   `E11000 duplicate key error collection: test.users index: name_1_age_1 dup key: { name: "a \"b\", c", age: 30 }`,
+			indexName: "name_1_age_1",
+			key:       bson.M{"name": `a "b", c`, "age": int64(30)},
+		},
+		{
+			name:      "nested document",
+			message:   `E11000 duplicate key error collection: test.users index: address_1 dup key: { address: { city: "x, y", zip: 123 } }`,
+			indexName: "address_1",
+			key:       bson.M{"address": bson.M{"city": "x, y", "zip": int64(123)}},
+		},
+		{
+			name:      "dotted field",
+			message:   `E11000 duplicate key error collection: test.users index: address.city_1 dup key: { address.city: null }`,
+			indexName: "address.city_1",
+			key:       bson.M{"address.city": nil},
+		},
+		{
+			name:      "date",
+			message:   `E11000 duplicate key error collection: test.events index: at_1 dup key: { at: new Date(1600000000000) }`,
+			indexName: "at_1",
+			key:       bson.M{"at": primitive.DateTime(1600000000000)},
+		},
+		{
+			name:      "4.0 without field names",
+			message:   `E11000 duplicate key error collection: test.users index: email_1 dup key: { : "a@b.com" }`,
+			indexName: "email_1",
+			key:       bson.M{"": "a@b.com"},
+		},
+		{
+			name:      "3.x index namespace",
+			message:   `E11000 duplicate key error index: test.users.$email_1  dup key: { : "a@b.com" }`,
+			indexName: "test.users.$email_1",
+			key:       bson.M{"": "a@b.com"},
+		},
+		{
+			name:      "no key",
+			message:   `E11000 duplicate key error collection: test.users index: email_1`,
+			indexName: "email_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexName, key := ParseDuplicateKeyMessage(tt.message)
+			if indexName != tt.indexName {
+				t.Errorf("index name: %q, expected %q", indexName, tt.indexName)
+			}
+			if !reflect.DeepEqual(key, tt.key) {
+				t.Errorf("key: %v, expected %v", key, tt.key)
+			}
+		})
+	}
+}
+
+func TestToDuplicateKeyErrorReadsDetails(t *testing.T) {
+	details, _ := bson.Marshal(bson.D{
+		{Key: "keyPattern", Value: bson.D{{Key: "name", Value: 1}, {Key: "age", Value: 1}}},
+		{Key: "keyValue", Value: bson.D{{Key: "name", Value: "a"}, {Key: "age", Value: int32(30)}}},
+	})
+	err := ToDuplicateKeyError(mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: test.users index: name_1_age_1 dup key: { : "a", : 30 }`,
+		Details: details,
+	}}})
+	var d *DuplicateKeyError
+	if !errors.As(err, &d) || !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("error: %v, expected *DuplicateKeyError", err)
+	}
+	if expected := (bson.M{"name": "a", "age": int32(30)}); !reflect.DeepEqual(d.Key, expected) {
+		t.Fatalf("key: %v, expected %v", d.Key, expected)
+	}
+
+	pattern, _ := bson.Marshal(bson.D{{Key: "keyPattern", Value: bson.D{{Key: "name", Value: 1}, {Key: "age", Value: 1}}}})
+	d = newWriteDuplicateKeyError(mongo.WriteError{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: test.users index: name_1_age_1 dup key: { : "a", : 30 }`,
+		Details: pattern,
+	})
+	if expected := (bson.M{"name": "a", "age": int64(30)}); !reflect.DeepEqual(d.Key, expected) {
+		t.Fatalf("key: %v, expected %v", d.Key, expected)
+	}
+}
@@ -0,0 +1,567 @@
+package mongo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// EncryptedPrefix marks the encrypted values, so that the plain values written before the encryption is enabled can still be loaded.
+const EncryptedPrefix = "enc:"
+
+// KeyProvider returns the AES key of id, 16, 24 or 32 bytes. If id is empty, it returns the current key and its id.
+type KeyProvider interface {
+	Key(ctx context.Context, id string) (string, []byte, error)
+}
+
+// KeyLister returns the ids of the active keys. If the KeyProvider is a KeyLister, the deterministic fields without a pinned key
+// are queried by the values encrypted by all active keys, so that the documents encrypted before a key rotation still match.
+type KeyLister interface {
+	KeyIds(ctx context.Context) ([]string, error)
+}
+
+// LocalKeyring keeps the keys in memory, for tests and for the keys loaded from the configuration.
+type LocalKeyring struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// NewLocalKeyring returns an error if current is not in keys, or if a key is not 16, 24 or 32 bytes.
+func NewLocalKeyring(current string, keys map[string][]byte) (*LocalKeyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current encryption key %s not found", current)
+	}
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("encryption key id %s is too long", id)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("encryption key %s must be 16, 24 or 32 bytes, not %d", id, len(key))
+		}
+	}
+	return &LocalKeyring{Current: current, Keys: keys}, nil
+}
+
+// KeyIds returns the ids of the keys, the current one first.
+func (k *LocalKeyring) KeyIds(ctx context.Context) ([]string, error) {
+	ids := make([]string, 0, len(k.Keys))
+	ids = append(ids, k.Current)
+	others := make([]string, 0, len(k.Keys))
+	for id := range k.Keys {
+		if id != k.Current {
+			others = append(others, id)
+		}
+	}
+	sort.Strings(others)
+	return append(ids, others...), nil
+}
+
+func (k *LocalKeyring) Key(ctx context.Context, id string) (string, []byte, error) {
+	if len(id) == 0 {
+		id = k.Current
+	}
+	key, ok := k.Keys[id]
+	if !ok {
+		return id, nil, fmt.Errorf("encryption key %s not found", id)
+	}
+	return id, key, nil
+}
+
+type encryptedField struct {
+	index         int
+	json          string
+	bson          string
+	deterministic bool
+	key           string
+}
+
+// EncryptionMapper encrypts the string and *string fields tagged by encrypt with AES-GCM on ModelToDb, and decrypts them on DbToModel.
+// The tag is `encrypt:"random"` or `encrypt:"deterministic"`, optionally with the key id: `encrypt:"deterministic,key=pii"`.
+// Deterministic fields have the same cipher text for the same value, so they can be matched by equality, see EncryptQuery.
+// They should pin their key id, else they cannot be matched after the current key is rotated.
+// ModelToDb encrypts a copy of the model, so the model of the caller keeps the plain values.
+// Mapper, if any, is applied to the plain model, before encryption and after decryption.
+type EncryptionMapper struct {
+	Keys      KeyProvider
+	Mapper    Mapper
+	modelType reflect.Type
+	fields    []encryptedField
+}
+
+func NewEncryptionMapper(modelType reflect.Type, keys KeyProvider, options ...Mapper) *EncryptionMapper {
+	var mapper Mapper
+	if len(options) > 0 && options[0] != nil {
+		mapper = options[0]
+	}
+	return &EncryptionMapper{Keys: keys, Mapper: mapper, modelType: modelType, fields: getEncryptedFields(modelType)}
+}
+
+func getEncryptedFields(modelType reflect.Type) []encryptedField {
+	fields := make([]encryptedField, 0)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		tag, ok := field.Tag.Lookup("encrypt")
+		if !ok || tag == "-" {
+			continue
+		}
+		if field.Type.Kind() != reflect.String && !(field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.String) {
+			log.Println("encrypt tag is ignored, because field " + field.Name + " is not a string")
+			continue
+		}
+		f := encryptedField{index: i, json: GetJsonByIndex(modelType, i), bson: GetBsonNameByIndex(modelType, i)}
+		for _, option := range strings.Split(tag, ",") {
+			option = strings.TrimSpace(option)
+			if option == "deterministic" {
+				f.deterministic = true
+			} else if strings.HasPrefix(option, "key=") {
+				f.key = option[len("key="):]
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func (m *EncryptionMapper) DbToModel(ctx context.Context, model interface{}) (interface{}, error) {
+	vo := reflect.Indirect(reflect.ValueOf(model))
+	if vo.Kind() == reflect.Ptr {
+		vo = reflect.Indirect(vo)
+	}
+	if vo.Kind() == reflect.Struct {
+		if err := m.decryptStruct(ctx, vo); err != nil {
+			return model, err
+		}
+	}
+	if m.Mapper != nil {
+		return m.Mapper.DbToModel(ctx, model)
+	}
+	return model, nil
+}
+
+func (m *EncryptionMapper) DbToModels(ctx context.Context, models interface{}) (interface{}, error) {
+	vo := reflect.Indirect(reflect.ValueOf(models))
+	if vo.Kind() == reflect.Slice {
+		for i := 0; i < vo.Len(); i++ {
+			item := vo.Index(i)
+			if item.Kind() == reflect.Struct {
+				item = item.Addr()
+			}
+			if _, err := m.DbToModel(ctx, item.Interface()); err != nil {
+				return models, err
+			}
+		}
+	}
+	return models, nil
+}
+
+func (m *EncryptionMapper) ModelToDb(ctx context.Context, model interface{}) (interface{}, error) {
+	var err error
+	if m.Mapper != nil {
+		if model, err = m.Mapper.ModelToDb(ctx, model); err != nil {
+			return model, err
+		}
+	}
+	if mp, ok := model.(map[string]interface{}); ok {
+		return m.encryptMap(ctx, mp)
+	}
+	vo := reflect.Indirect(reflect.ValueOf(model))
+	if vo.Kind() != reflect.Struct {
+		return model, nil
+	}
+	c := reflect.New(vo.Type())
+	c.Elem().Set(vo)
+	if err = m.encryptStruct(ctx, c.Elem()); err != nil {
+		return model, err
+	}
+	return c.Interface(), nil
+}
+
+func (m *EncryptionMapper) ModelsToDb(ctx context.Context, models interface{}) (interface{}, error) {
+	vo := reflect.Indirect(reflect.ValueOf(models))
+	if vo.Kind() != reflect.Slice {
+		return models, nil
+	}
+	c := reflect.MakeSlice(vo.Type(), vo.Len(), vo.Len())
+	for i := 0; i < vo.Len(); i++ {
+		item := vo.Index(i)
+		m2, err := m.ModelToDb(ctx, item.Interface())
+		if err != nil {
+			return models, err
+		}
+		if item.Kind() == reflect.Ptr {
+			c.Index(i).Set(reflect.ValueOf(m2))
+		} else {
+			c.Index(i).Set(reflect.Indirect(reflect.ValueOf(m2)))
+		}
+	}
+	return c.Interface(), nil
+}
+
+func (m *EncryptionMapper) encryptStruct(ctx context.Context, vo reflect.Value) error {
+	for _, f := range m.fields {
+		field := vo.Field(f.index)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			s, err := m.encrypt(ctx, f, field.Elem().String())
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(&s))
+		} else if field.Len() > 0 {
+			s, err := m.encrypt(ctx, f, field.String())
+			if err != nil {
+				return err
+			}
+			field.SetString(s)
+		}
+	}
+	return nil
+}
+
+func (m *EncryptionMapper) decryptStruct(ctx context.Context, vo reflect.Value) error {
+	for _, f := range m.fields {
+		field := vo.Field(f.index)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			s, err := m.Decrypt(ctx, field.Elem().String())
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(&s))
+		} else {
+			s, err := m.Decrypt(ctx, field.String())
+			if err != nil {
+				return err
+			}
+			field.SetString(s)
+		}
+	}
+	return nil
+}
+
+func (m *EncryptionMapper) encryptMap(ctx context.Context, model map[string]interface{}) (map[string]interface{}, error) {
+	c := make(map[string]interface{}, len(model))
+	for k, v := range model {
+		c[k] = v
+	}
+	for _, f := range m.fields {
+		v, ok := c[f.json]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := plainValue(v).(string)
+		if !ok {
+			return model, fmt.Errorf("encrypted field %s must be a string", f.json)
+		}
+		if len(s) == 0 {
+			continue
+		}
+		encrypted, err := m.encrypt(ctx, f, s)
+		if err != nil {
+			return model, err
+		}
+		c[f.json] = encrypted
+	}
+	return c, nil
+}
+
+// encrypt returns EncryptedPrefix and the base64 of the key id, the nonce and the cipher text, encrypted by the key of the field.
+func (m *EncryptionMapper) encrypt(ctx context.Context, f encryptedField, plain string) (string, error) {
+	return m.encryptWithKey(ctx, f, f.key, plain)
+}
+
+func (m *EncryptionMapper) encryptWithKey(ctx context.Context, f encryptedField, id string, plain string) (string, error) {
+	keyId, key, err := m.Keys.Key(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if len(keyId) > 255 {
+		return "", fmt.Errorf("encryption key id %s is too long", keyId)
+	}
+	encryptionKey, macKey, err := deriveKeys(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if f.deterministic {
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write([]byte(f.bson))
+		mac.Write([]byte{0})
+		mac.Write([]byte(plain))
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := make([]byte, 0, 1+len(keyId)+len(nonce)+len(plain)+gcm.Overhead())
+	data = append(data, byte(len(keyId)))
+	data = append(data, keyId...)
+	data = append(data, nonce...)
+	data = gcm.Seal(data, nonce, []byte(plain), []byte(keyId))
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// deriveKeys derives the AES key and the HMAC key of the deterministic nonces from key by HKDF, so that the same key is not used by both.
+func deriveKeys(key []byte) ([]byte, []byte, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, not %d", len(key))
+	}
+	encryptionKey := make([]byte, len(key))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("mongo field encryption")), encryptionKey); err != nil {
+		return nil, nil, err
+	}
+	macKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("mongo deterministic nonce")), macKey); err != nil {
+		return nil, nil, err
+	}
+	return encryptionKey, macKey, nil
+}
+
+// Decrypt returns the plain value of an encrypted value. The values without EncryptedPrefix are returned as they are.
+func (m *EncryptionMapper) Decrypt(ctx context.Context, value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return value, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value[len(EncryptedPrefix):])
+	if err != nil {
+		return "", err
+	}
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", errors.New("invalid encrypted value")
+	}
+	keyId := string(data[1 : 1+int(data[0])])
+	data = data[1+int(data[0]):]
+	_, key, err := m.Keys.Key(ctx, keyId)
+	if err != nil {
+		return "", err
+	}
+	encryptionKey, _, err := deriveKeys(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(keyId))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptQuery encrypts the equality conditions of the deterministic fields of a query, such as the query built by query.Build,
+// including the conditions nested in $and, $or and $nor.
+// The conditions on the random fields and the regular expressions on the deterministic fields cannot be matched, so they return an error.
+// query.Build matches the string fields by regular expressions, unless they are tagged match:"equal", see CheckFilter.
+// The fields without a pinned key are matched by the values encrypted by all keys of a KeyLister, else by the current key only,
+// so the documents encrypted by a previous key must be encrypted again after the rotation.
+func (m *EncryptionMapper) EncryptQuery(ctx context.Context, query bson.M) (bson.M, error) {
+	keyIds, err := m.queryKeyIds(ctx)
+	if err != nil {
+		return query, err
+	}
+	return m.encryptQuery(ctx, query, keyIds)
+}
+
+func (m *EncryptionMapper) queryKeyIds(ctx context.Context) ([]string, error) {
+	if lister, ok := m.Keys.(KeyLister); ok {
+		return lister.KeyIds(ctx)
+	}
+	return nil, nil
+}
+
+func (m *EncryptionMapper) encryptQuery(ctx context.Context, query bson.M, keyIds []string) (bson.M, error) {
+	q := bson.M{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for _, op := range []string{"$and", "$or", "$nor"} {
+		v, ok := q[op]
+		if !ok {
+			continue
+		}
+		conditions := bson.A{}
+		for _, item := range toArray(v) {
+			sub, ok := toMap(item)
+			if !ok {
+				return query, fmt.Errorf("%s must be an array of documents", op)
+			}
+			encrypted, err := m.encryptQuery(ctx, sub, keyIds)
+			if err != nil {
+				return query, err
+			}
+			conditions = append(conditions, encrypted)
+		}
+		q[op] = conditions
+	}
+	for _, f := range m.fields {
+		v, ok := q[f.bson]
+		if !ok || v == nil {
+			continue
+		}
+		if !f.deterministic {
+			return query, fmt.Errorf("field %s is not encrypted deterministically, so it cannot be queried", f.bson)
+		}
+		ids := keyIds
+		if len(f.key) > 0 || len(ids) == 0 {
+			ids = []string{f.key}
+		}
+		encrypted, err := m.encryptCondition(ctx, f, v, ids)
+		if err != nil {
+			return query, err
+		}
+		q[f.bson] = encrypted
+	}
+	return q, nil
+}
+
+// encryptValues returns the values of plain encrypted by the keys.
+func (m *EncryptionMapper) encryptValues(ctx context.Context, f encryptedField, plain string, keyIds []string) (bson.A, error) {
+	values := bson.A{}
+	for _, id := range keyIds {
+		v, err := m.encryptWithKey(ctx, f, id, plain)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (m *EncryptionMapper) encryptCondition(ctx context.Context, f encryptedField, condition interface{}, keyIds []string) (interface{}, error) {
+	switch c := plainValue(condition).(type) {
+	case string:
+		values, err := m.encryptValues(ctx, f, c, keyIds)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return bson.M{"$in": values}, nil
+	case primitive.Regex:
+		return nil, fmt.Errorf("field %s is encrypted, so it cannot be matched by a regular expression, it must be tagged match:\"equal\" in the filter", f.bson)
+	}
+	operators, ok := toMap(condition)
+	if !ok {
+		return nil, fmt.Errorf("field %s is encrypted, so it can be matched by a string only", f.bson)
+	}
+	encrypted := bson.M{}
+	for op, operand := range operators {
+		switch op {
+		case "$eq", "$ne", "$in", "$nin":
+			items := bson.A{operand}
+			if op == "$in" || op == "$nin" {
+				items = toArray(operand)
+			}
+			arr := bson.A{}
+			for _, item := range items {
+				s, ok := plainValue(item).(string)
+				if !ok {
+					return nil, fmt.Errorf("field %s is encrypted, so it can be matched by a string only", f.bson)
+				}
+				values, err := m.encryptValues(ctx, f, s, keyIds)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, values...)
+			}
+			if (op == "$eq" || op == "$ne") && len(arr) == 1 {
+				encrypted[op] = arr[0]
+			} else if op == "$eq" || op == "$in" {
+				encrypted["$in"] = arr
+			} else {
+				encrypted["$nin"] = arr
+			}
+		case "$exists":
+			encrypted[op] = operand
+		default:
+			return nil, fmt.Errorf("field %s is encrypted, so it cannot be matched by %s", f.bson, op)
+		}
+	}
+	return encrypted, nil
+}
+
+// CheckFilter returns an error if a string field of filterType, which is built by query.Build, is an encrypted field of the model,
+// and is not random and tagged match:"equal" and, if it has a keyword tag, keyword:"equal". Else query.Build matches it by a regular expression,
+// which cannot match the encrypted values.
+func (m *EncryptionMapper) CheckFilter(filterType reflect.Type) error {
+	for filterType.Kind() == reflect.Ptr {
+		filterType = filterType.Elem()
+	}
+	for i := 0; i < filterType.NumField(); i++ {
+		field := filterType.Field(i)
+		if field.Type.Kind() != reflect.String && !(field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.String) {
+			continue
+		}
+		modelField, ok := m.modelType.FieldByName(field.Name)
+		if !ok {
+			continue
+		}
+		for _, f := range m.fields {
+			if f.index != modelField.Index[0] || len(modelField.Index) != 1 {
+				continue
+			}
+			if !f.deterministic {
+				return fmt.Errorf("field %s is not encrypted deterministically, so it cannot be a filter field", field.Name)
+			}
+			if match := field.Tag.Get("match"); match != "equal" {
+				return fmt.Errorf("filter field %s must be tagged match:\"equal\", because %s is encrypted", field.Name, f.bson)
+			}
+			if keyword, ok := field.Tag.Lookup("keyword"); ok && keyword != "equal" {
+				return fmt.Errorf("filter field %s must be tagged keyword:\"equal\", because %s is encrypted", field.Name, f.bson)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildQuery wraps the buildQuery of a searcher, to encrypt its conditions with EncryptQuery, and can be set to the BuildFilter of SearchBuilder or AggregateSearcher.
+// If a condition cannot be encrypted, the error is returned, so the search fails instead of matching nothing.
+func (m *EncryptionMapper) BuildQuery(buildQuery func(interface{}) (bson.M, bson.M)) func(context.Context, interface{}) (bson.M, bson.M, error) {
+	return func(ctx context.Context, sm interface{}) (bson.M, bson.M, error) {
+		query, fields := buildQuery(sm)
+		encrypted, err := m.EncryptQuery(ctx, query)
+		if err != nil {
+			return nil, fields, err
+		}
+		return encrypted, fields, nil
+	}
+}
@@ -0,0 +1,113 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type encryptedUser struct {
+	Id    string  `json:"id" bson:"_id"`
+	Email string  `json:"email" bson:"email" encrypt:"deterministic"`
+	Phone *string `json:"phone" bson:"phone" encrypt:"random"`
+}
+
+func newTestEncryptionMapper(t *testing.T, current string) (*EncryptionMapper, *LocalKeyring) {
+	keys, err := NewLocalKeyring(current, map[string][]byte{
+		"k1": []byte("0123456789abcdef0123456789abcdef"),
+		"k2": []byte("fedcba9876543210"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptionMapper(reflect.TypeOf(encryptedUser{}), keys), keys
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestEncryptionMapper(t, "k1")
+	phone := "0123456789"
+	user := &encryptedUser{Id: "1", Email: "a@b.c", Phone: &phone}
+
+	db1, err := m.ModelToDb(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2, err := m.ModelToDb(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e1, e2 := db1.(*encryptedUser), db2.(*encryptedUser)
+	if user.Email != "a@b.c" || *user.Phone != phone {
+		t.Fatalf("the model of the caller is changed: %v", user)
+	}
+	if !strings.HasPrefix(e1.Email, EncryptedPrefix) || !strings.HasPrefix(*e1.Phone, EncryptedPrefix) {
+		t.Fatalf("the fields are not encrypted: %v %v", e1.Email, *e1.Phone)
+	}
+	if e1.Email != e2.Email {
+		t.Errorf("deterministic values are different: %s %s", e1.Email, e2.Email)
+	}
+	if *e1.Phone == *e2.Phone {
+		t.Errorf("random values are the same: %s", *e1.Phone)
+	}
+	for _, e := range []*encryptedUser{e1, e2} {
+		if _, err = m.DbToModel(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Email != user.Email || *e.Phone != phone {
+			t.Errorf("decrypted values are %s %s", e.Email, *e.Phone)
+		}
+	}
+}
+
+func TestEncryptQuery(t *testing.T) {
+	ctx := context.Background()
+	old, _ := newTestEncryptionMapper(t, "k2")
+	m, _ := newTestEncryptionMapper(t, "k1")
+	db, err := old.ModelToDb(ctx, &encryptedUser{Id: "1", Email: "a@b.c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := db.(*encryptedUser).Email
+
+	q, err := m.EncryptQuery(ctx, bson.M{"$or": bson.A{bson.M{"email": "a@b.c"}, bson.M{"_id": "2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := q["$or"].(bson.A)[0].(bson.M)["email"].(bson.M)["$in"].(bson.A)
+	if len(in) != 2 || in[1] != stored {
+		t.Errorf("the value encrypted by the previous key is not queried: %v", in)
+	}
+	if _, err = m.EncryptQuery(ctx, bson.M{"email": primitive.Regex{Pattern: "a"}}); err == nil {
+		t.Error("a regular expression on an encrypted field must fail")
+	}
+	if _, err = m.EncryptQuery(ctx, bson.M{"$and": bson.A{bson.M{"phone": "1"}}}); err == nil {
+		t.Error("a random field must not be queried")
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	m, _ := newTestEncryptionMapper(t, "k1")
+	type contain struct{ Email string }
+	type equal struct {
+		Email string `match:"equal"`
+	}
+	if m.CheckFilter(reflect.TypeOf(contain{})) == nil {
+		t.Error("a filter field without match equal must fail")
+	}
+	if err := m.CheckFilter(reflect.TypeOf(&equal{})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewLocalKeyring(t *testing.T) {
+	if _, err := NewLocalKeyring("k", map[string][]byte{"k": []byte("short")}); err == nil {
+		t.Error("a short key must fail")
+	}
+	if _, err := NewLocalKeyring("x", map[string][]byte{"k": make([]byte, 16)}); err == nil {
+		t.Error("a missing current key must fail")
+	}
+}
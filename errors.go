@@ -0,0 +1,12 @@
+package mongo
+
+import "errors"
+
+var (
+	// ErrVersionConflict is returned when a document exists, but its version does not match the version of the model.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrNotFound is returned when a versioned update does not find the document.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateKey is returned when an insert violates a unique index.
+	ErrDuplicateKey = errors.New("duplicate key")
+)
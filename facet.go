@@ -0,0 +1,145 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"strings"
+)
+
+const (
+	facetResults = "__results"
+	facetTotal   = "__total"
+)
+
+type FacetBucket struct {
+	Value interface{} `json:"value" bson:"_id"`
+	Count int64       `json:"count" bson:"count"`
+}
+
+// GetFacetFields returns the facets declared in the search model by the facet tag, as a map of json name to bson name.
+// The bson name is the tag value if it is not empty, else the bson name of the field of the result model that has the same json name.
+//
+//	Status []string `json:"status,omitempty" facet:""`
+func GetFacetFields(sm interface{}, resultModelType reflect.Type) map[string]string {
+	facets := make(map[string]string)
+	smType := reflect.TypeOf(sm)
+	for smType != nil && smType.Kind() == reflect.Ptr {
+		smType = smType.Elem()
+	}
+	if smType == nil || smType.Kind() != reflect.Struct {
+		return facets
+	}
+	numField := smType.NumField()
+	for i := 0; i < numField; i++ {
+		field := smType.Field(i)
+		bsonName, ok := field.Tag.Lookup("facet")
+		if !ok {
+			continue
+		}
+		jsonName := field.Name
+		if tag, ok1 := field.Tag.Lookup("json"); ok1 {
+			jsonName = strings.Split(tag, ",")[0]
+		}
+		if len(bsonName) == 0 {
+			bsonName = GetBsonNameForSort(resultModelType, jsonName)
+		}
+		facets[jsonName] = bsonName
+	}
+	return facets
+}
+
+// BuildFacetSearchResult gets the page of results, the total and the bucket counts of facets in one $facet aggregation.
+// facets is a map of facet name to bson name. If countMode is CountNone, the total is -1.
+func BuildFacetSearchResult(ctx context.Context, collection *mongo.Collection, results interface{}, query bson.M, fields bson.M, sort bson.M, pageIndex int64, pageSize int64, initPageSize int64, facets map[string]string, countMode CountMode, opts ...func(context.Context, interface{}) (interface{}, error)) (int64, map[string][]FacetBucket, error) {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(opts) > 0 {
+		mp = opts[0]
+	}
+	pipeline := mongo.Pipeline{}
+	if len(query) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: query}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: BuildFacetStage(fields, sort, pageIndex, pageSize, initPageSize, facets, countMode)}})
+	cursor, er0 := collection.Aggregate(ctx, pipeline)
+	if er0 != nil {
+		return 0, nil, er0
+	}
+	defer cursor.Close(ctx)
+	if !cursor.Next(ctx) {
+		return 0, nil, cursor.Err()
+	}
+	total, er1 := DecodeFacetResult(cursor.Current, results, countMode)
+	if er1 != nil {
+		return 0, nil, er1
+	}
+	buckets := make(map[string][]FacetBucket)
+	for name := range facets {
+		var b []FacetBucket
+		if v, er2 := cursor.Current.LookupErr(name); er2 == nil {
+			if er3 := v.Unmarshal(&b); er3 != nil {
+				return 0, nil, er3
+			}
+		}
+		buckets[name] = b
+	}
+	if mp != nil {
+		if _, er4 := MapModels(ctx, results, mp); er4 != nil {
+			return total, buckets, er4
+		}
+	}
+	return total, buckets, nil
+}
+
+func BuildFacetStage(fields bson.M, sort bson.M, pageIndex int64, pageSize int64, initPageSize int64, facets map[string]string, countMode CountMode) bson.M {
+	page := bson.A{}
+	if len(sort) > 0 {
+		page = append(page, bson.M{"$sort": sort})
+	}
+	skip, limit := GetSkipAndLimit(pageIndex, pageSize, initPageSize)
+	if skip > 0 {
+		page = append(page, bson.M{"$skip": skip})
+	}
+	if limit > 0 {
+		page = append(page, bson.M{"$limit": limit})
+	}
+	if len(fields) > 0 {
+		page = append(page, bson.M{"$project": fields})
+	}
+	stage := bson.M{facetResults: page}
+	if countMode != CountNone {
+		stage[facetTotal] = bson.A{bson.M{"$count": "count"}}
+	}
+	for name, bsonName := range facets {
+		stage[name] = bson.A{
+			bson.M{"$unwind": "$" + bsonName},
+			bson.M{"$sortByCount": "$" + bsonName},
+		}
+	}
+	return stage
+}
+
+// DecodeFacetResult decodes the page of results and the total of the document built by BuildFacetStage.
+func DecodeFacetResult(doc bson.Raw, results interface{}, countMode CountMode) (int64, error) {
+	if v, err := doc.LookupErr(facetResults); err == nil {
+		if er1 := v.Unmarshal(results); er1 != nil {
+			return 0, er1
+		}
+	}
+	if countMode == CountNone {
+		return -1, nil
+	}
+	var totals []struct {
+		Count int64 `bson:"count"`
+	}
+	if v, err := doc.LookupErr(facetTotal); err == nil {
+		if er2 := v.Unmarshal(&totals); er2 != nil {
+			return 0, er2
+		}
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+	return totals[0].Count, nil
+}
@@ -10,6 +10,7 @@ import (
 type FieldLoader struct {
 	Collection *mongo.Collection
 	Name       string
+	SoftDelete *SoftDeleteConfig
 }
 
 func NewFieldLoader(db *mongo.Database, collectionName string, name string) *FieldLoader {
@@ -23,7 +24,7 @@ func NewFieldLoader(db *mongo.Database, collectionName string, name string) *Fie
 func (l *FieldLoader) Values(ctx context.Context, ids []string) ([]string, error) {
 	var array []string
 	var finalResult []bson.M
-	query := bson.M{l.Name: bson.M{"$in": ids}}
+	query := ExcludeDeleted(bson.M{l.Name: bson.M{"$in": ids}}, l.SoftDelete)
 
 	findOptions := options.Find() // build a `findOptions`
 	findOptions.SetSort(map[string]int{l.Name: 1})
@@ -0,0 +1,50 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	mgo "github.com/core-go/mongo"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var errInvalidModelType = errors.New("result is not a slice of the model type")
+
+type Loader[T any] struct {
+	*mgo.Loader
+}
+
+func NewMongoLoader[T any](db *mongo.Database, collectionName string, idObjectId bool, options ...func(context.Context, interface{}) (interface{}, error)) *Loader[T] {
+	return NewMongoLoaderWithSoftDelete[T](db, collectionName, idObjectId, nil, options...)
+}
+
+func NewMongoLoaderWithSoftDelete[T any](db *mongo.Database, collectionName string, idObjectId bool, softDelete *mgo.SoftDeleteConfig, options ...func(context.Context, interface{}) (interface{}, error)) *Loader[T] {
+	modelType := reflect.TypeOf(new(T)).Elem()
+	return &Loader[T]{mgo.NewMongoLoaderWithSoftDelete(db, collectionName, modelType, idObjectId, softDelete, options...)}
+}
+
+func NewLoader[T any](db *mongo.Database, collectionName string, options ...func(context.Context, interface{}) (interface{}, error)) *Loader[T] {
+	return NewMongoLoader[T](db, collectionName, false, options...)
+}
+
+func (l *Loader[T]) All(ctx context.Context) ([]T, error) {
+	r, err := l.Loader.All(ctx)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	models, ok := r.(*[]T)
+	if !ok {
+		return nil, errInvalidModelType
+	}
+	return *models, nil
+}
+
+func (l *Loader[T]) Load(ctx context.Context, id interface{}) (*T, error) {
+	var model T
+	ok, err := l.Loader.LoadAndDecode(ctx, id, &model)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &model, nil
+}
@@ -0,0 +1,71 @@
+package generic
+
+import (
+	"context"
+	"reflect"
+
+	mgo "github.com/core-go/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Searcher[T any] struct {
+	*mgo.Searcher
+}
+
+func NewSearcher[T any](search func(context.Context, interface{}, interface{}, int64, int64, ...int64) (int64, error)) *Searcher[T] {
+	return &Searcher[T]{mgo.NewSearcher(search)}
+}
+
+func (s *Searcher[T]) Search(ctx context.Context, m interface{}, pageIndex int64, pageSize int64, options ...int64) ([]T, int64, error) {
+	var results []T
+	total, err := s.Searcher.Search(ctx, m, &results, pageIndex, pageSize, options...)
+	return results, total, err
+}
+
+func (s *Searcher[T]) SearchByToken(ctx context.Context, m interface{}, limit int64, nextPageToken string, count bool) ([]T, string, int64, error) {
+	var results []T
+	next, total, err := s.Searcher.SearchByToken(ctx, m, &results, limit, nextPageToken, count)
+	return results, next, total, err
+}
+
+func NewMongoSearchWriterWithVersionAndSort[T any](db *mongo.Database, collectionName string, idObjectId bool, version string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...mgo.Mapper) (*Searcher[T], *Writer[T]) {
+	var mapper mgo.Mapper
+	if len(options) > 0 && options[0] != nil {
+		mapper = options[0]
+	}
+	if mapper != nil {
+		writer := NewWriterWithVersion[T](db, collectionName, idObjectId, version, mapper)
+		builder := mgo.NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort, mapper.DbToModel)
+		return &Searcher[T]{mgo.NewSearcherWithToken(builder.Search, builder.SearchByToken)}, writer
+	}
+	writer := NewWriterWithVersion[T](db, collectionName, idObjectId, version)
+	builder := mgo.NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort)
+	return &Searcher[T]{mgo.NewSearcherWithToken(builder.Search, builder.SearchByToken)}, writer
+}
+
+func NewSearchWriterWithVersionAndSort[T any](db *mongo.Database, collectionName string, version string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...mgo.Mapper) (*Searcher[T], *Writer[T]) {
+	return NewMongoSearchWriterWithVersionAndSort[T](db, collectionName, false, version, buildQuery, getSort, buildSort, options...)
+}
+func NewSearchWriterWithVersion[T any](db *mongo.Database, collectionName string, version string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...mgo.Mapper) (*Searcher[T], *Writer[T]) {
+	return NewMongoSearchWriterWithVersionAndSort[T](db, collectionName, false, version, buildQuery, getSort, mgo.BuildSort, options...)
+}
+func NewSearchWriterWithSort[T any](db *mongo.Database, collectionName string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...mgo.Mapper) (*Searcher[T], *Writer[T]) {
+	return NewMongoSearchWriterWithVersionAndSort[T](db, collectionName, false, "", buildQuery, getSort, buildSort, options...)
+}
+func NewSearchWriter[T any](db *mongo.Database, collectionName string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...mgo.Mapper) (*Searcher[T], *Writer[T]) {
+	return NewMongoSearchWriterWithVersionAndSort[T](db, collectionName, false, "", buildQuery, getSort, mgo.BuildSort, options...)
+}
+
+func NewSearchLoaderWithQueryAndSort[T any](db *mongo.Database, collectionName string, idObjectId bool, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...func(context.Context, interface{}) (interface{}, error)) (*Searcher[T], *Loader[T]) {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(options) > 0 && options[0] != nil {
+		mp = options[0]
+	}
+	loader := NewMongoLoader[T](db, collectionName, idObjectId, mp)
+	builder := mgo.NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort, mp)
+	return &Searcher[T]{mgo.NewSearcherWithToken(builder.Search, builder.SearchByToken)}, loader
+}
+func NewSearchLoaderWithQuery[T any](db *mongo.Database, collectionName string, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) (*Searcher[T], *Loader[T]) {
+	return NewSearchLoaderWithQueryAndSort[T](db, collectionName, false, buildQuery, getSort, mgo.BuildSort, options...)
+}
@@ -0,0 +1,23 @@
+package generic
+
+import (
+	"context"
+
+	mgo "github.com/core-go/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Stream iterates all models one at a time, and returns the _id of the last handled model, to resume with mgo.StreamOptions.After.
+func (l *Loader[T]) Stream(ctx context.Context, handle func(ctx context.Context, model *T) error, opts ...mgo.StreamOptions) (interface{}, error) {
+	return l.StreamByQuery(ctx, bson.M{}, handle, opts...)
+}
+
+func (l *Loader[T]) StreamByQuery(ctx context.Context, query bson.M, handle func(ctx context.Context, model *T) error, opts ...mgo.StreamOptions) (interface{}, error) {
+	return l.Loader.StreamByQuery(ctx, query, func(ctx context.Context, model interface{}) error {
+		m, ok := model.(*T)
+		if !ok {
+			return errInvalidModelType
+		}
+		return handle(ctx, m)
+	}, opts...)
+}
@@ -0,0 +1,29 @@
+//go:build go1.23
+
+package generic
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	mgo "github.com/core-go/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var errStopIteration = errors.New("stop iteration")
+
+// Iterate returns an iterator over the models of query, decoded one at a time. An error is yielded with a nil model, and ends the iteration.
+func (l *Loader[T]) Iterate(ctx context.Context, query bson.M, opts ...mgo.StreamOptions) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		_, err := l.StreamByQuery(ctx, query, func(ctx context.Context, model *T) error {
+			if !yield(model, nil) {
+				return errStopIteration
+			}
+			return nil
+		}, opts...)
+		if err != nil && err != errStopIteration {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package generic
+
+import (
+	"context"
+	"reflect"
+
+	mgo "github.com/core-go/mongo"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Writer[T any] struct {
+	*Loader[T]
+	writer *mgo.Writer
+}
+
+func NewWriterWithVersion[T any](db *mongo.Database, collectionName string, idObjectId bool, versionField string, options ...mgo.Mapper) *Writer[T] {
+	return NewWriterWithSoftDelete[T](db, collectionName, idObjectId, versionField, nil, options...)
+}
+func NewWriterWithSoftDelete[T any](db *mongo.Database, collectionName string, idObjectId bool, versionField string, softDelete *mgo.SoftDeleteConfig, options ...mgo.Mapper) *Writer[T] {
+	modelType := reflect.TypeOf(new(T)).Elem()
+	writer := mgo.NewWriterWithSoftDelete(db, collectionName, modelType, idObjectId, versionField, softDelete, options...)
+	return &Writer[T]{Loader: &Loader[T]{writer.Loader}, writer: writer}
+}
+func NewDefaultWriter[T any](db *mongo.Database, collectionName string, versionField string, options ...mgo.Mapper) *Writer[T] {
+	return NewWriterWithVersion[T](db, collectionName, false, versionField, options...)
+}
+func NewWriter[T any](db *mongo.Database, collectionName string, options ...mgo.Mapper) *Writer[T] {
+	return NewWriterWithVersion[T](db, collectionName, false, "", options...)
+}
+
+// Writer returns the reflect.Type based writer, to be used where a *mongo.Writer is expected.
+func (w *Writer[T]) Writer() *mgo.Writer {
+	return w.writer
+}
+
+func (w *Writer[T]) Insert(ctx context.Context, model *T) (int64, error) {
+	return w.writer.Insert(ctx, model)
+}
+
+func (w *Writer[T]) Update(ctx context.Context, model *T) (int64, error) {
+	return w.writer.Update(ctx, model)
+}
+
+func (w *Writer[T]) Patch(ctx context.Context, model map[string]interface{}) (int64, error) {
+	return w.writer.Patch(ctx, model)
+}
+
+func (w *Writer[T]) Save(ctx context.Context, model *T) (int64, error) {
+	return w.writer.Save(ctx, model)
+}
+
+func (w *Writer[T]) Delete(ctx context.Context, id interface{}) (int64, error) {
+	return w.writer.Delete(ctx, id)
+}
+
+func (w *Writer[T]) Restore(ctx context.Context, id interface{}) (int64, error) {
+	return w.writer.Restore(ctx, id)
+}
+
+func (w *Writer[T]) Purge(ctx context.Context, id interface{}) (int64, error) {
+	return w.writer.Purge(ctx, id)
+}
@@ -0,0 +1,407 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IndexSpec is an index declared by the index tag of a model.
+//
+// The tag has one or more specs separated by ';'. A spec is an optional name, then options separated by ',':
+// unique, sparse, desc, text, 2dsphere, ttl=<seconds>, partial=<extended json>, collation=<locale>[:<strength>].
+// The fields with the same index name make a compound index, in the order of the struct fields.
+//
+//	Email     string    `bson:"email" index:"unique,collation=en:2"`
+//	Status    string    `bson:"status" index:"status_createdAt;status_active,partial={\"active\":true}"`
+//	CreatedAt time.Time `bson:"createdAt" index:"status_createdAt,desc;ttl=86400"`
+type IndexSpec struct {
+	Name               string
+	Keys               bson.D
+	Unique             bool
+	Sparse             bool
+	ExpireAfterSeconds *int32
+	PartialFilter      bson.D
+	Collation          *options.Collation
+}
+
+type IndexDiff struct {
+	Create []IndexSpec
+	Change []IndexSpec
+	Drop   []string
+}
+
+func (d *IndexDiff) Empty() bool {
+	return len(d.Create) == 0 && len(d.Change) == 0 && len(d.Drop) == 0
+}
+
+func (d *IndexDiff) String() string {
+	var s []string
+	for _, c := range d.Create {
+		s = append(s, "create "+c.Name)
+	}
+	for _, c := range d.Change {
+		s = append(s, "change "+c.Name)
+	}
+	for _, c := range d.Drop {
+		s = append(s, "drop "+c)
+	}
+	return strings.Join(s, ", ")
+}
+
+type IndexSynchronizer struct {
+	Collection *mongo.Collection
+	Indexes    []IndexSpec
+	// DropUndeclared drops the existing indexes that are not declared. The _id index is never dropped.
+	DropUndeclared bool
+	// DryRun makes Sync report the differences without applying them.
+	DryRun bool
+}
+
+func NewIndexSynchronizer(db *mongo.Database, collectionName string, modelType reflect.Type, options ...bool) (*IndexSynchronizer, error) {
+	indexes, err := GetIndexSpecs(modelType)
+	if err != nil {
+		return nil, err
+	}
+	s := &IndexSynchronizer{Collection: db.Collection(collectionName), Indexes: indexes}
+	if len(options) > 0 {
+		s.DryRun = options[0]
+	}
+	if len(options) > 1 {
+		s.DropUndeclared = options[1]
+	}
+	return s, nil
+}
+
+func (s *IndexSynchronizer) Sync(ctx context.Context) (*IndexDiff, error) {
+	diff, err := s.Diff(ctx)
+	if err != nil || s.DryRun || diff.Empty() {
+		return diff, err
+	}
+	for _, name := range diff.Drop {
+		if _, er1 := s.Collection.Indexes().DropOne(ctx, name); er1 != nil {
+			return diff, er1
+		}
+	}
+	for _, spec := range diff.Change {
+		if _, er2 := s.Collection.Indexes().DropOne(ctx, spec.Name); er2 != nil {
+			return diff, er2
+		}
+	}
+	models := make([]mongo.IndexModel, 0)
+	for _, spec := range append(diff.Change, diff.Create...) {
+		models = append(models, spec.Model())
+	}
+	if len(models) > 0 {
+		if _, er3 := s.Collection.Indexes().CreateMany(ctx, models); er3 != nil {
+			return diff, er3
+		}
+	}
+	return diff, nil
+}
+
+func (s *IndexSynchronizer) Diff(ctx context.Context) (*IndexDiff, error) {
+	existing, err := ListIndexSpecs(ctx, s.Collection)
+	if err != nil {
+		return nil, err
+	}
+	return DiffIndexes(s.Indexes, existing, s.DropUndeclared), nil
+}
+
+// DiffIndexes compares the declared indexes with the existing ones by name.
+// An existing index with the same keys but another name is changed, because the server does not allow two indexes on the same keys.
+func DiffIndexes(declared []IndexSpec, existing []IndexSpec, dropUndeclared bool) *IndexDiff {
+	diff := &IndexDiff{}
+	used := make(map[string]bool)
+	for _, d := range declared {
+		var found *IndexSpec
+		for i := range existing {
+			if existing[i].Name == d.Name {
+				found = &existing[i]
+				break
+			}
+		}
+		if found == nil {
+			for i := range existing {
+				if existing[i].Name != "_id_" && canonicalIndexKeys(existing[i].Keys) == canonicalIndexKeys(d.Keys) {
+					found = &existing[i]
+					break
+				}
+			}
+		}
+		if found == nil {
+			diff.Create = append(diff.Create, d)
+			continue
+		}
+		used[found.Name] = true
+		if found.Name != d.Name {
+			diff.Drop = append(diff.Drop, found.Name)
+			diff.Create = append(diff.Create, d)
+		} else if !sameIndex(d, *found) {
+			diff.Change = append(diff.Change, d)
+		}
+	}
+	if dropUndeclared {
+		for _, e := range existing {
+			if e.Name != "_id_" && !used[e.Name] {
+				diff.Drop = append(diff.Drop, e.Name)
+			}
+		}
+	}
+	return diff
+}
+
+func (spec IndexSpec) Model() mongo.IndexModel {
+	opts := options.Index().SetName(spec.Name)
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if spec.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*spec.ExpireAfterSeconds)
+	}
+	if len(spec.PartialFilter) > 0 {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	if spec.Collation != nil {
+		opts.SetCollation(spec.Collation)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: opts}
+}
+
+func ListIndexSpecs(ctx context.Context, collection *mongo.Collection) ([]IndexSpec, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []struct {
+		Name                    string             `bson:"name"`
+		Key                     bson.D             `bson:"key"`
+		Unique                  bool               `bson:"unique"`
+		Sparse                  bool               `bson:"sparse"`
+		ExpireAfterSeconds      interface{}        `bson:"expireAfterSeconds"`
+		PartialFilterExpression bson.D             `bson:"partialFilterExpression"`
+		Collation               *options.Collation `bson:"collation"`
+		Weights                 bson.D             `bson:"weights"`
+	}
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+	specs := make([]IndexSpec, 0)
+	for _, x := range indexes {
+		spec := IndexSpec{Name: x.Name, Unique: x.Unique, Sparse: x.Sparse, PartialFilter: x.PartialFilterExpression, Collation: x.Collation}
+		if ttl, ok := toFloat(x.ExpireAfterSeconds); ok {
+			v := int32(ttl)
+			spec.ExpireAfterSeconds = &v
+		}
+		for _, k := range x.Key {
+			if k.Key == "_fts" || k.Key == "_ftsx" {
+				continue
+			}
+			spec.Keys = append(spec.Keys, k)
+		}
+		for _, w := range x.Weights {
+			spec.Keys = append(spec.Keys, bson.E{Key: w.Key, Value: "text"})
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func sameIndex(a IndexSpec, b IndexSpec) bool {
+	if canonicalIndexKeys(a.Keys) != canonicalIndexKeys(b.Keys) || a.Unique != b.Unique || a.Sparse != b.Sparse {
+		return false
+	}
+	if (a.ExpireAfterSeconds == nil) != (b.ExpireAfterSeconds == nil) || (a.ExpireAfterSeconds != nil && *a.ExpireAfterSeconds != *b.ExpireAfterSeconds) {
+		return false
+	}
+	if (a.Collation == nil) != (b.Collation == nil) || (a.Collation != nil && (a.Collation.Locale != b.Collation.Locale || (a.Collation.Strength != 0 && a.Collation.Strength != b.Collation.Strength))) {
+		return false
+	}
+	return canonicalValue(a.PartialFilter) == canonicalValue(b.PartialFilter)
+}
+
+// canonicalIndexKeys keeps the order of the keys, except the text keys, which are sorted, because the server returns them as weights.
+func canonicalIndexKeys(keys bson.D) string {
+	var s, text []string
+	for _, k := range keys {
+		if k.Value == "text" {
+			text = append(text, k.Key)
+			continue
+		}
+		s = append(s, k.Key+":"+canonicalValue(k.Value))
+	}
+	sort.Strings(text)
+	if len(text) > 0 {
+		s = append(s, "text("+strings.Join(text, ",")+")")
+	}
+	return strings.Join(s, ",")
+}
+
+func canonicalValue(v interface{}) string {
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case bson.D:
+		if len(x) == 0 {
+			return ""
+		}
+		var s []string
+		for _, e := range x {
+			s = append(s, e.Key+":"+canonicalValue(e.Value))
+		}
+		return "{" + strings.Join(s, ",") + "}"
+	case bson.A:
+		var s []string
+		for _, e := range x {
+			s = append(s, canonicalValue(e))
+		}
+		return "[" + strings.Join(s, ",") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+// GetIndexSpecs reads the index tags of modelType.
+func GetIndexSpecs(modelType reflect.Type) ([]IndexSpec, error) {
+	specs := make([]IndexSpec, 0)
+	positions := make(map[string]int)
+	numField := modelType.NumField()
+	for i := 0; i < numField; i++ {
+		field := modelType.Field(i)
+		tag, ok := field.Tag.Lookup("index")
+		if !ok {
+			continue
+		}
+		bsonName := GetBsonNameByIndex(modelType, i)
+		if len(bsonName) == 0 || bsonName == "-" {
+			bsonName = field.Name
+		}
+		for _, s := range splitTag(tag, ';') {
+			spec, err := parseIndexSpec(bsonName, s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index tag of %s.%s: %w", modelType.Name(), field.Name, err)
+			}
+			if p, exist := positions[spec.Name]; exist {
+				merged := &specs[p]
+				merged.Keys = append(merged.Keys, spec.Keys...)
+				merged.Unique = merged.Unique || spec.Unique
+				merged.Sparse = merged.Sparse || spec.Sparse
+				if spec.ExpireAfterSeconds != nil {
+					merged.ExpireAfterSeconds = spec.ExpireAfterSeconds
+				}
+				if len(spec.PartialFilter) > 0 {
+					merged.PartialFilter = spec.PartialFilter
+				}
+				if spec.Collation != nil {
+					merged.Collation = spec.Collation
+				}
+			} else {
+				positions[spec.Name] = len(specs)
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs, nil
+}
+
+func parseIndexSpec(bsonName string, s string) (IndexSpec, error) {
+	var spec IndexSpec
+	var direction interface{} = 1
+	for i, o := range splitTag(s, ',') {
+		o = strings.TrimSpace(o)
+		key, value := o, ""
+		if p := strings.Index(o, "="); p >= 0 {
+			key, value = o[:p], o[p+1:]
+		}
+		switch key {
+		case "":
+		case "unique":
+			spec.Unique = true
+		case "sparse":
+			spec.Sparse = true
+		case "desc":
+			direction = -1
+		case "text", "2dsphere", "2d", "hashed":
+			direction = key
+		case "ttl":
+			ttl, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return spec, fmt.Errorf("ttl must be a number of seconds: %s", value)
+			}
+			t := int32(ttl)
+			spec.ExpireAfterSeconds = &t
+		case "partial":
+			var filter bson.D
+			if err := bson.UnmarshalExtJSON([]byte(value), false, &filter); err != nil {
+				return spec, fmt.Errorf("partial must be an extended json document: %w", err)
+			}
+			spec.PartialFilter = filter
+		case "collation":
+			locale, strength := value, ""
+			if p := strings.Index(value, ":"); p >= 0 {
+				locale, strength = value[:p], value[p+1:]
+			}
+			spec.Collation = &options.Collation{Locale: locale}
+			if len(strength) > 0 {
+				n, err := strconv.Atoi(strength)
+				if err != nil {
+					return spec, fmt.Errorf("collation strength must be a number: %s", strength)
+				}
+				spec.Collation.Strength = n
+			}
+		default:
+			if i > 0 || len(value) > 0 {
+				return spec, fmt.Errorf("unknown index option %s", key)
+			}
+			spec.Name = key
+		}
+	}
+	spec.Keys = bson.D{{Key: bsonName, Value: direction}}
+	if len(spec.Name) == 0 {
+		spec.Name = bsonName + "_" + fmt.Sprint(direction)
+	}
+	return spec, nil
+}
+
+// splitTag splits s by sep, except inside {} or [], so that partial filters can have commas.
+func splitTag(s string, sep rune) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch {
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
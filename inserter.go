@@ -8,6 +8,8 @@ import (
 type Inserter struct {
 	collection *mongo.Collection
 	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	Auditor    *Auditor
+	Retry      *RetryPolicy
 }
 
 func NewInserter(database *mongo.Database, collectionName string, options ...func(context.Context, interface{}) (interface{}, error)) *Inserter {
@@ -20,7 +22,14 @@ func NewInserter(database *mongo.Database, collectionName string, options ...fun
 }
 
 func (w *Inserter) Write(ctx context.Context, model interface{}) error {
+	return w.Retry.Do(ctx, func(ctx context.Context) error {
+		return w.write(ctx, model)
+	})
+}
+
+func (w *Inserter) write(ctx context.Context, model interface{}) error {
 	var err error
+	w.Auditor.Create(ctx, model)
 	if w.Map != nil {
 		m2, er0 := w.Map(ctx, model)
 		if er0 != nil {
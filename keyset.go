@@ -0,0 +1,244 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+)
+
+var ErrInvalidNextPageToken = errors.New("invalid next page token")
+
+// ErrSortFieldsRequired is returned by SearchByToken if the searcher has a custom BuildSort, but not BuildSortFields,
+// because BuildSort does not keep the order of the sort fields.
+var ErrSortFieldsRequired = errors.New("keyset pagination requires BuildSortFields, the order of the fields of BuildSort is lost")
+
+// BuildKeysetSearchResult loads the page after nextPageToken, without skip.
+// sort is completed with _id, so that the order is unique. The returned token is empty on the last page.
+func BuildKeysetSearchResult(ctx context.Context, collection *mongo.Collection, results interface{}, query bson.M, fields bson.M, sort bson.D, limit int64, nextPageToken string, opts ...func(context.Context, interface{}) (interface{}, error)) (string, error) {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(opts) > 0 {
+		mp = opts[0]
+	}
+	sort = withIdSort(sort)
+	filter := query
+	if len(nextPageToken) > 0 {
+		values, err := DecodeNextPageToken(nextPageToken, sort)
+		if err != nil {
+			return "", err
+		}
+		filter = BuildKeysetQuery(query, sort, values)
+	}
+	optionsFind := options.Find()
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for k, v := range fields {
+			projection[k] = v
+		}
+		for _, e := range sort {
+			projection[e.Key] = 1
+		}
+		optionsFind.SetProjection(projection)
+	}
+	optionsFind.SetSort(sort)
+	if limit > 0 {
+		optionsFind.SetLimit(limit + 1)
+	}
+	cursor, er1 := collection.Find(ctx, filter, optionsFind)
+	if er1 != nil {
+		return "", er1
+	}
+	if er2 := cursor.All(ctx, results); er2 != nil {
+		return "", er2
+	}
+	var next string
+	rv := reflect.Indirect(reflect.ValueOf(results))
+	if limit > 0 && int64(rv.Len()) > limit {
+		rv.Set(rv.Slice(0, int(limit)))
+		token, er3 := BuildNextPageToken(rv.Index(int(limit)-1).Interface(), sort)
+		if er3 != nil {
+			return "", er3
+		}
+		next = token
+	}
+	if mp != nil {
+		if _, er4 := MapModels(ctx, results, mp); er4 != nil {
+			return next, er4
+		}
+	}
+	return next, nil
+}
+
+func withIdSort(sort bson.D) bson.D {
+	direction := 1
+	for _, e := range sort {
+		if e.Key == "_id" {
+			return sort
+		}
+		direction = sortDirection(e.Value)
+	}
+	s := make(bson.D, 0, len(sort)+1)
+	s = append(s, sort...)
+	return append(s, bson.E{Key: "_id", Value: direction})
+}
+
+// sortDirection returns -1 if the direction of a sort field, of any number type, is negative, else 1.
+func sortDirection(v interface{}) int {
+	if d, ok := toNumber(v); ok && d < 0 {
+		return -1
+	}
+	return 1
+}
+
+// BuildKeysetQuery adds to query the condition to get the documents after values, in the order of sort.
+// The null and missing values are sorted before the other values, as mongo does: after null, the ascending fields are not null,
+// and the descending fields are less or null.
+func BuildKeysetQuery(query bson.M, sort bson.D, values bson.D) bson.M {
+	or := make(bson.A, 0)
+	for i := 0; i < len(sort) && i < len(values); i++ {
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[sort[j].Key] = values[j].Value
+		}
+		key, value := sort[i].Key, values[i].Value
+		if sortDirection(sort[i].Value) > 0 {
+			if value == nil {
+				condition[key] = bson.M{"$ne": nil}
+			} else {
+				condition[key] = bson.M{"$gt": value}
+			}
+		} else {
+			if value == nil {
+				// nothing is sorted after null in descending order
+				continue
+			}
+			condition["$or"] = bson.A{bson.M{key: bson.M{"$lt": value}}, bson.M{key: nil}}
+		}
+		or = append(or, condition)
+	}
+	if len(or) == 0 {
+		// the last page is read
+		or = append(or, bson.M{"_id": bson.M{"$exists": false}})
+	}
+	keyset := bson.M{"$or": or}
+	if len(query) == 0 {
+		return keyset
+	}
+	return bson.M{"$and": bson.A{query, keyset}}
+}
+
+// BuildNextPageToken encodes the values of the sort fields of model into an opaque token.
+// The values are read from the fields of model, not from its bson, where the zero values of the omitempty fields are missing.
+func BuildNextPageToken(model interface{}, sort bson.D) (string, error) {
+	values := make(bson.D, 0, len(sort))
+	for _, e := range sort {
+		values = append(values, bson.E{Key: e.Key, Value: sortValue(reflect.ValueOf(model), strings.Split(e.Key, "."))})
+	}
+	data, err := bson.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// sortValue returns the value of the path of bson names in v, which can be a struct, a map or a bson.D, or nil if it is not found.
+func sortValue(v reflect.Value, path []string) interface{} {
+	for len(path) > 0 {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		var ok bool
+		switch v.Kind() {
+		case reflect.Struct:
+			v, ok = bsonField(v, path[0])
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			v = v.MapIndex(reflect.ValueOf(path[0]).Convert(v.Type().Key()))
+			ok = v.IsValid()
+		default:
+			if d, isD := v.Interface().(bson.D); isD {
+				v, ok = elementValue(d, path[0])
+			}
+		}
+		if !ok {
+			return nil
+		}
+		path = path[1:]
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// bsonField returns the field of the struct v named name in bson, by its bson tag or its lower case name, also in the inline structs.
+func bsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("bson"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" {
+			if f := reflect.Indirect(v.Field(i)); f.Kind() == reflect.Struct {
+				if fv, ok := bsonField(f, name); ok {
+					return fv, true
+				}
+			}
+			continue
+		}
+		fieldName := tag[0]
+		if len(fieldName) == 0 {
+			fieldName = strings.ToLower(field.Name)
+		}
+		if fieldName == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func elementValue(d bson.D, key string) (reflect.Value, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return reflect.ValueOf(&e.Value).Elem(), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func DecodeNextPageToken(token string, sort bson.D) (bson.D, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidNextPageToken
+	}
+	var values bson.D
+	if err := bson.Unmarshal(data, &values); err != nil {
+		return nil, ErrInvalidNextPageToken
+	}
+	if len(values) != len(sort) {
+		return nil, ErrInvalidNextPageToken
+	}
+	for i := range sort {
+		if values[i].Key != sort[i].Key {
+			return nil, ErrInvalidNextPageToken
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,91 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+type keysetItem struct {
+	Id    string  `bson:"_id"`
+	Name  *string `bson:"name"`
+	Score int32   `bson:"score"`
+}
+
+func TestNextPageToken(t *testing.T) {
+	name := "a"
+	sort := withIdSort(bson.D{{Key: "name", Value: int32(1)}, {Key: "score", Value: float64(-1)}})
+	if !reflect.DeepEqual(sort[2], bson.E{Key: "_id", Value: -1}) {
+		t.Fatalf("id sort: %v, expected the direction of the last field", sort[2])
+	}
+	token, err := BuildNextPageToken(keysetItem{Id: "1", Name: &name, Score: 5}, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := DecodeNextPageToken(token, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bson.D{{Key: "name", Value: "a"}, {Key: "score", Value: int32(5)}, {Key: "_id", Value: "1"}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("values: %v, expected %v", values, expected)
+	}
+	if _, err := DecodeNextPageToken(token, sort[1:]); err != ErrInvalidNextPageToken {
+		t.Fatalf("token of other sort: %v, expected ErrInvalidNextPageToken", err)
+	}
+	if _, err := DecodeNextPageToken("?", sort); err != ErrInvalidNextPageToken {
+		t.Fatalf("invalid token: %v, expected ErrInvalidNextPageToken", err)
+	}
+}
+
+func TestBuildKeysetQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   bson.D
+		values bson.D
+		or     bson.A
+	}{
+		{
+			name:   "ascending and descending",
+			sort:   bson.D{{Key: "name", Value: int32(1)}, {Key: "score", Value: int64(-1)}, {Key: "_id", Value: -1}},
+			values: bson.D{{Key: "name", Value: "a"}, {Key: "score", Value: 5}, {Key: "_id", Value: "1"}},
+			or: bson.A{
+				bson.M{"name": bson.M{"$gt": "a"}},
+				bson.M{"name": "a", "$or": bson.A{bson.M{"score": bson.M{"$lt": 5}}, bson.M{"score": nil}}},
+				bson.M{"name": "a", "score": 5, "$or": bson.A{bson.M{"_id": bson.M{"$lt": "1"}}, bson.M{"_id": nil}}},
+			},
+		},
+		{
+			name:   "null ascending",
+			sort:   bson.D{{Key: "name", Value: 1.0}, {Key: "_id", Value: 1}},
+			values: bson.D{{Key: "name", Value: nil}, {Key: "_id", Value: "1"}},
+			or: bson.A{
+				bson.M{"name": bson.M{"$ne": nil}},
+				bson.M{"name": nil, "_id": bson.M{"$gt": "1"}},
+			},
+		},
+		{
+			name:   "null descending",
+			sort:   bson.D{{Key: "name", Value: -1}, {Key: "_id", Value: -1}},
+			values: bson.D{{Key: "name", Value: nil}, {Key: "_id", Value: "1"}},
+			or: bson.A{
+				bson.M{"name": nil, "$or": bson.A{bson.M{"_id": bson.M{"$lt": "1"}}, bson.M{"_id": nil}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := BuildKeysetQuery(nil, tt.sort, tt.values)
+			if !reflect.DeepEqual(q, bson.M{"$or": tt.or}) {
+				t.Fatalf("query: %v, expected %v", q, bson.M{"$or": tt.or})
+			}
+		})
+	}
+
+	query := bson.M{"status": "A"}
+	q := BuildKeysetQuery(query, bson.D{{Key: "_id", Value: 1}}, bson.D{{Key: "_id", Value: "1"}})
+	expected := bson.M{"$and": bson.A{query, bson.M{"$or": bson.A{bson.M{"_id": bson.M{"$gt": "1"}}}}}}
+	if !reflect.DeepEqual(q, expected) {
+		t.Fatalf("query: %v, expected %v", q, expected)
+	}
+}
@@ -16,9 +16,14 @@ type Loader struct {
 	jsonIdName string
 	idIndex    int
 	idObjectId bool
+	SoftDelete *SoftDeleteConfig
 }
 
 func NewMongoLoader(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, options ...func(context.Context, interface{}) (interface{}, error)) *Loader {
+	return NewMongoLoaderWithSoftDelete(db, collectionName, modelType, idObjectId, nil, options...)
+}
+
+func NewMongoLoaderWithSoftDelete(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, softDelete *SoftDeleteConfig, options ...func(context.Context, interface{}) (interface{}, error)) *Loader {
 	idIndex, _, jsonIdName := FindIdField(modelType)
 	if idIndex < 0 {
 		log.Println(modelType.Name() + " loader can't use functions that need Id value (Ex Load, Exist, Save, Update) because don't have any fields of " + modelType.Name() + " struct define _id bson tag.")
@@ -27,7 +32,7 @@ func NewMongoLoader(db *mongo.Database, collectionName string, modelType reflect
 	if len(options) > 0 {
 		mp = options[0]
 	}
-	return &Loader{db.Collection(collectionName), mp, modelType, jsonIdName, idIndex, idObjectId}
+	return &Loader{db.Collection(collectionName), mp, modelType, jsonIdName, idIndex, idObjectId, softDelete}
 }
 
 func NewLoader(db *mongo.Database, collectionName string, modelType reflect.Type, options ...func(context.Context, interface{}) (interface{}, error)) *Loader {
@@ -45,7 +50,8 @@ func (m *Loader) Id() string {
 func (m *Loader) All(ctx context.Context) (interface{}, error) {
 	modelsType := reflect.Zero(reflect.SliceOf(m.modelType)).Type()
 	result := reflect.New(modelsType).Interface()
-	v, err := FindAndDecode(ctx, m.Collection, bson.M{}, result)
+	query := ExcludeDeleted(bson.M{}, m.SoftDelete)
+	v, err := FindAndDecode(ctx, m.Collection, query, result)
 	if v {
 		if m.Map != nil {
 			return MapModels(ctx, result, m.Map)
@@ -56,7 +62,11 @@ func (m *Loader) All(ctx context.Context) (interface{}, error) {
 }
 
 func (m *Loader) Load(ctx context.Context, id interface{}) (interface{}, error) {
-	r, er1 := FindOneWithId(ctx, m.Collection, id, m.idObjectId, m.modelType)
+	query, er0 := m.buildIdQuery(id)
+	if er0 != nil {
+		return nil, er0
+	}
+	r, er1 := FindOne(ctx, m.Collection, query, m.modelType)
 	if er1 != nil {
 		return r, er1
 	}
@@ -71,23 +81,10 @@ func (m *Loader) Load(ctx context.Context, id interface{}) (interface{}, error)
 }
 
 func (m *Loader) LoadAndDecode(ctx context.Context, id interface{}, result interface{}) (bool, error) {
-	if m.idObjectId {
-		objId := id.(string)
-		objectId, err := primitive.ObjectIDFromHex(objId)
-		if err != nil {
-			return false, err
-		}
-		query := bson.M{"_id": objectId}
-		ok, er0 := FindOneAndDecode(ctx, m.Collection, query, result)
-		if ok && er0 == nil && m.Map != nil {
-			_, er2 := m.Map(ctx, result)
-			if er2 != nil {
-				return ok, er2
-			}
-		}
-		return ok, er0
+	query, er0 := m.buildIdQuery(id)
+	if er0 != nil {
+		return false, er0
 	}
-	query := bson.M{"_id": id}
 	ok, er2 := FindOneAndDecode(ctx, m.Collection, query, result)
 	if ok && er2 == nil && m.Map != nil {
 		_, er3 := m.Map(ctx, result)
@@ -99,5 +96,24 @@ func (m *Loader) LoadAndDecode(ctx context.Context, id interface{}, result inter
 }
 
 func (m *Loader) Exist(ctx context.Context, id interface{}) (bool, error) {
-	return Exist(ctx, m.Collection, id, m.idObjectId)
+	if m.SoftDelete == nil {
+		return Exist(ctx, m.Collection, id, m.idObjectId)
+	}
+	query, err := m.buildIdQuery(id)
+	if err != nil {
+		return false, err
+	}
+	return ExistByQuery(ctx, m.Collection, query)
+}
+
+func (m *Loader) buildIdQuery(id interface{}) (bson.M, error) {
+	query := bson.M{"_id": id}
+	if m.idObjectId {
+		objectId, err := primitive.ObjectIDFromHex(id.(string))
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"_id": objectId}
+	}
+	return ExcludeDeleted(query, m.SoftDelete), nil
 }
@@ -0,0 +1,721 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCollection keeps documents in memory, to unit test the code that depends on ModelLoader, ModelWriter, ModelSearcher or PasscodeStore without mongod.
+// The documents are encoded by bson, so bson tags are honoured.
+// The queries support equality, primitive.Regex, $in, $nin, $gt, $gte, $lt, $lte, $ne, $exists, $and and $or, which covers the queries built by query.Build.
+type MemoryCollection struct {
+	mu   sync.RWMutex
+	docs []bson.M
+}
+
+func NewMemoryCollection() *MemoryCollection {
+	return &MemoryCollection{docs: make([]bson.M, 0)}
+}
+
+func (c *MemoryCollection) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.docs)
+}
+
+func (c *MemoryCollection) Find(query bson.M) []bson.M {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	docs := make([]bson.M, 0)
+	for _, doc := range c.docs {
+		if MatchQuery(doc, query) {
+			docs = append(docs, copyDocument(doc))
+		}
+	}
+	return docs
+}
+
+// InsertOne returns false if a document with the same _id exists.
+func (c *MemoryCollection) InsertOne(doc bson.M) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.docs {
+		if equalValues(d["_id"], doc["_id"]) {
+			return false
+		}
+	}
+	c.docs = append(c.docs, copyDocument(doc))
+	return true
+}
+
+// UpdateOne sets the fields of set to the first document matching query, and returns the matched count.
+func (c *MemoryCollection) UpdateOne(query bson.M, set bson.M) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, doc := range c.docs {
+		if MatchQuery(doc, query) {
+			for k, v := range set {
+				doc[k] = v
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (c *MemoryCollection) UnsetOne(query bson.M, fields ...string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, doc := range c.docs {
+		if MatchQuery(doc, query) {
+			for _, k := range fields {
+				delete(doc, k)
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (c *MemoryCollection) DeleteOne(query bson.M) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, doc := range c.docs {
+		if MatchQuery(doc, query) {
+			c.docs = append(c.docs[:i], c.docs[i+1:]...)
+			return 1
+		}
+	}
+	return 0
+}
+
+func (c *MemoryCollection) Exist(query bson.M) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, doc := range c.docs {
+		if MatchQuery(doc, query) {
+			return true
+		}
+	}
+	return false
+}
+
+type MemoryLoader struct {
+	Collection *MemoryCollection
+	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	SoftDelete *SoftDeleteConfig
+	modelType  reflect.Type
+	jsonIdName string
+	idIndex    int
+	idObjectId bool
+}
+
+func NewMemoryLoader(collection *MemoryCollection, modelType reflect.Type, idObjectId bool, options ...func(context.Context, interface{}) (interface{}, error)) *MemoryLoader {
+	idIndex, _, jsonIdName := FindIdField(modelType)
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(options) > 0 {
+		mp = options[0]
+	}
+	return &MemoryLoader{Collection: collection, Map: mp, modelType: modelType, jsonIdName: jsonIdName, idIndex: idIndex, idObjectId: idObjectId}
+}
+
+func (m *MemoryLoader) Id() string {
+	return m.jsonIdName
+}
+
+func (m *MemoryLoader) All(ctx context.Context) (interface{}, error) {
+	docs := m.Collection.Find(ExcludeDeleted(bson.M{}, m.SoftDelete))
+	result := reflect.New(reflect.SliceOf(m.modelType)).Interface()
+	if err := decodeDocuments(docs, result); err != nil {
+		return nil, err
+	}
+	if m.Map != nil {
+		return MapModels(ctx, result, m.Map)
+	}
+	return result, nil
+}
+
+func (m *MemoryLoader) Load(ctx context.Context, id interface{}) (interface{}, error) {
+	result := reflect.New(m.modelType).Interface()
+	ok, err := m.LoadAndDecode(ctx, id, result)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (m *MemoryLoader) LoadAndDecode(ctx context.Context, id interface{}, result interface{}) (bool, error) {
+	query, er0 := m.buildIdQuery(id)
+	if er0 != nil {
+		return false, er0
+	}
+	docs := m.Collection.Find(query)
+	if len(docs) == 0 {
+		return false, nil
+	}
+	if er1 := decodeDocument(docs[0], result); er1 != nil {
+		return true, er1
+	}
+	if m.Map != nil {
+		if _, er2 := m.Map(ctx, result); er2 != nil {
+			return true, er2
+		}
+	}
+	return true, nil
+}
+
+func (m *MemoryLoader) Exist(ctx context.Context, id interface{}) (bool, error) {
+	query, err := m.buildIdQuery(id)
+	if err != nil {
+		return false, err
+	}
+	return m.Collection.Exist(query), nil
+}
+
+func (m *MemoryLoader) buildIdQuery(id interface{}) (bson.M, error) {
+	query := bson.M{"_id": id}
+	if m.idObjectId {
+		objectId, err := primitive.ObjectIDFromHex(id.(string))
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"_id": objectId}
+	}
+	return ExcludeDeleted(query, m.SoftDelete), nil
+}
+
+// MemoryWriter has the same semantics as Writer, including the optimistic locking by the version field.
+type MemoryWriter struct {
+	*MemoryLoader
+	maps         map[string]string
+	versionField string
+	versionIndex int
+	Mapper       Mapper
+	Auditor      *Auditor
+}
+
+func NewMemoryWriter(collection *MemoryCollection, modelType reflect.Type, idObjectId bool, versionField string, options ...Mapper) *MemoryWriter {
+	var mapper Mapper
+	var loader *MemoryLoader
+	if len(options) > 0 && options[0] != nil {
+		mapper = options[0]
+		loader = NewMemoryLoader(collection, modelType, idObjectId, mapper.DbToModel)
+	} else {
+		loader = NewMemoryLoader(collection, modelType, idObjectId)
+	}
+	versionIndex := -1
+	if len(versionField) > 0 {
+		versionIndex = FindFieldIndex(modelType, versionField)
+	}
+	if versionIndex < 0 {
+		versionField = ""
+	}
+	return &MemoryWriter{MemoryLoader: loader, maps: MakeBsonMap(modelType), versionField: versionField, versionIndex: versionIndex, Mapper: mapper}
+}
+
+func (m *MemoryWriter) toDb(ctx context.Context, model interface{}) (interface{}, error) {
+	if m.Mapper == nil {
+		return model, nil
+	}
+	return m.Mapper.ModelToDb(ctx, model)
+}
+
+func (m *MemoryWriter) Insert(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Create(ctx, model)
+	m2, err := m.toDb(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	var res int64
+	if m.versionIndex < 0 {
+		res, err = m.insert(m2)
+	} else {
+		res, err = m.insertWithVersion(m2)
+	}
+	if err == nil {
+		copyKeys(model, m2, m.idIndex, m.versionIndex)
+	}
+	return res, err
+}
+
+func (m *MemoryWriter) insertWithVersion(model interface{}) (int64, error) {
+	model, err := setDefaultVersion(model, m.versionIndex)
+	if err != nil {
+		return 0, err
+	}
+	return m.insert(model)
+}
+
+func (m *MemoryWriter) insert(model interface{}) (int64, error) {
+	doc, err := toDocument(model)
+	if err != nil {
+		return 0, err
+	}
+	id, exist := doc["_id"]
+	if !exist {
+		objectId := primitive.NewObjectID()
+		doc["_id"] = objectId
+		id = objectId
+	}
+	if !m.Collection.InsertOne(doc) {
+		message := fmt.Sprintf("E11000 duplicate key error collection: memory index: _id_ dup key: { _id: %v }", id)
+		return 0, &DuplicateKeyError{IndexName: "_id_", Key: bson.M{"_id": id}, Message: message}
+	}
+	if objectId, ok := id.(primitive.ObjectID); ok && m.idIndex >= 0 {
+		vo := reflect.ValueOf(model)
+		if vo.Kind() == reflect.Ptr {
+			mapObjectIdToModel(objectId, vo, m.idIndex)
+		}
+	}
+	return 1, nil
+}
+
+func (m *MemoryWriter) Update(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Update(ctx, model)
+	m2, err := m.toDb(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	idQuery := BuildQueryByIdFromObject(m2)
+	query := idQuery
+	if m.versionIndex >= 0 {
+		if query, err = buildIdAndVersionQuery(idQuery, m2, m.versionIndex); err != nil {
+			return 0, err
+		}
+	}
+	res, err := m.update(idQuery, query, m2, m.Auditor.CreatedFields(model)...)
+	if err == nil {
+		copyKeys(model, m2, m.versionIndex)
+	}
+	return res, err
+}
+
+func (m *MemoryWriter) Patch(ctx context.Context, model map[string]interface{}) (int64, error) {
+	m.Auditor.Patch(ctx, m.modelType, model, GetJsonByIndex)
+	m2, err := m.toDb(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	m3, ok := m2.(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("result of ModelToDb must be a map[string]interface{}")
+	}
+	idQuery := BuildQueryByIdFromMap(m3, GetJsonByIndex(m.modelType, m.idIndex))
+	query := idQuery
+	if m.versionIndex >= 0 {
+		if query, err = buildIdAndVersionQueryByMap(idQuery, m3, m.maps, m.versionField, m.modelType.Field(m.versionIndex).Type); err != nil {
+			return 0, err
+		}
+	}
+	res, err := m.update(idQuery, query, MapToBson(m3, m.maps))
+	if err == nil && m.versionIndex >= 0 {
+		copyMapKeys(model, m3, m.versionField)
+	}
+	return res, err
+}
+
+func (m *MemoryWriter) Save(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Save(ctx, model)
+	m2, err := m.toDb(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	res, err := m.save(m2, m.Auditor.CreatedFields(model)...)
+	if err == nil {
+		copyKeys(model, m2, m.idIndex, m.versionIndex)
+	}
+	return res, err
+}
+
+func (m *MemoryWriter) save(model interface{}, createdFields ...string) (int64, error) {
+	idQuery := BuildQueryByIdFromObject(model)
+	defaultObjID, _ := primitive.ObjectIDFromHex("000000000000")
+	if idValue := idQuery["_id"]; idValue == "" || idValue == 0 || idValue == defaultObjID || !m.Collection.Exist(idQuery) {
+		if m.versionIndex >= 0 {
+			return m.insertWithVersion(model)
+		}
+		return m.insert(model)
+	}
+	query := idQuery
+	if m.versionIndex >= 0 {
+		var err error
+		if query, err = buildIdAndVersionQuery(idQuery, model, m.versionIndex); err != nil {
+			return 0, err
+		}
+	}
+	return m.update(idQuery, query, model, createdFields...)
+}
+
+// update returns -1 and ErrVersionConflict if the document exists, but the version does not match, as UpdateByIdAndVersion.
+// The omitted fields are kept, such as createdBy and createdAt when a document is saved again.
+func (m *MemoryWriter) update(idQuery bson.M, query bson.M, model interface{}, omitFields ...string) (int64, error) {
+	doc, err := toDocument(model)
+	if err != nil {
+		return 0, err
+	}
+	for _, field := range omitFields {
+		delete(doc, field)
+	}
+	if n := m.Collection.UpdateOne(query, doc); n > 0 {
+		return n, nil
+	}
+	if m.versionIndex < 0 {
+		return 0, nil
+	}
+	if m.Collection.Exist(idQuery) {
+		return -1, ErrVersionConflict
+	}
+	return 0, ErrNotFound
+}
+
+func (m *MemoryWriter) Delete(ctx context.Context, id interface{}) (int64, error) {
+	query := bson.M{"_id": id}
+	if m.SoftDelete != nil {
+		set := bson.M{m.SoftDelete.DeletedAt: primitive.NewDateTimeFromTime(time.Now())}
+		if len(m.SoftDelete.DeletedBy) > 0 {
+			set[m.SoftDelete.DeletedBy] = GetString(ctx, m.SoftDelete.User)
+		}
+		return m.Collection.UpdateOne(ExcludeDeleted(query, m.SoftDelete), set), nil
+	}
+	return m.Collection.DeleteOne(query), nil
+}
+
+func (m *MemoryWriter) Restore(ctx context.Context, id interface{}) (int64, error) {
+	if m.SoftDelete == nil {
+		return 0, fmt.Errorf("soft delete is not configured for this writer")
+	}
+	query := bson.M{"_id": id, m.SoftDelete.DeletedAt: bson.M{"$ne": nil}}
+	return m.Collection.UnsetOne(query, m.SoftDelete.DeletedAt, m.SoftDelete.DeletedBy), nil
+}
+
+func (m *MemoryWriter) Purge(ctx context.Context, id interface{}) (int64, error) {
+	return m.Collection.DeleteOne(bson.M{"_id": id}), nil
+}
+
+type MemorySearcher struct {
+	Collection *MemoryCollection
+	BuildQuery func(m interface{}) (bson.M, bson.M)
+	GetSort    func(m interface{}) string
+	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	SoftDelete *SoftDeleteConfig
+}
+
+func NewMemorySearcher(collection *MemoryCollection, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) *MemorySearcher {
+	var mp func(context.Context, interface{}) (interface{}, error)
+	if len(options) > 0 && options[0] != nil {
+		mp = options[0]
+	}
+	return &MemorySearcher{Collection: collection, BuildQuery: buildQuery, GetSort: getSort, Map: mp}
+}
+
+func (s *MemorySearcher) Search(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options ...int64) (int64, error) {
+	query, fields := s.BuildQuery(m)
+	query = ExcludeDeleted(query, s.SoftDelete)
+	docs := s.Collection.Find(query)
+
+	modelType := reflect.TypeOf(results).Elem().Elem()
+	SortDocuments(docs, BuildSortFields(s.GetSort(m), modelType))
+	var firstPageSize int64
+	if len(options) > 0 && options[0] > 0 {
+		firstPageSize = options[0]
+	}
+	total := int64(len(docs))
+	skip, limit := GetSkipAndLimit(pageIndex, pageSize, firstPageSize)
+	if skip > total {
+		skip = total
+	}
+	docs = docs[skip:]
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+	if len(fields) > 0 {
+		for i, doc := range docs {
+			projected := bson.M{"_id": doc["_id"]}
+			for k := range fields {
+				if v, ok := doc[k]; ok {
+					projected[k] = v
+				}
+			}
+			docs[i] = projected
+		}
+	}
+	if err := decodeDocuments(docs, results); err != nil {
+		return 0, err
+	}
+	if s.Map != nil {
+		if _, err := MapModels(ctx, results, s.Map); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+type MemoryPasscodeRepository struct {
+	mu        sync.Mutex
+	passcodes map[string]memoryPasscode
+}
+
+type memoryPasscode struct {
+	passcode  string
+	expiredAt time.Time
+}
+
+func NewMemoryPasscodeRepository() *MemoryPasscodeRepository {
+	return &MemoryPasscodeRepository{passcodes: make(map[string]memoryPasscode)}
+}
+
+func (p *MemoryPasscodeRepository) Save(ctx context.Context, id string, passcode string, expiredAt time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.passcodes[id] = memoryPasscode{passcode: passcode, expiredAt: expiredAt}
+	return 1, nil
+}
+
+func (p *MemoryPasscodeRepository) Load(ctx context.Context, id string) (string, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if code, ok := p.passcodes[id]; ok {
+		return code.passcode, code.expiredAt, nil
+	}
+	return "", time.Now().Add(-24 * time.Hour), nil
+}
+
+func (p *MemoryPasscodeRepository) Delete(ctx context.Context, id string) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.passcodes[id]; !ok {
+		return 0, nil
+	}
+	delete(p.passcodes, id)
+	return 1, nil
+}
+
+func toDocument(model interface{}) (bson.M, error) {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func copyDocument(doc bson.M) bson.M {
+	c := bson.M{}
+	for k, v := range doc {
+		c[k] = v
+	}
+	return c
+}
+
+func decodeDocument(doc bson.M, result interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
+
+func decodeDocuments(docs []bson.M, results interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(results))
+	elemType := rv.Type().Elem()
+	slice := reflect.MakeSlice(rv.Type(), 0, len(docs))
+	for _, doc := range docs {
+		item := reflect.New(elemType)
+		if err := decodeDocument(doc, item.Interface()); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, item.Elem())
+	}
+	rv.Set(slice)
+	return nil
+}
+
+// SortDocuments sorts docs by the fields of sort, in order. The missing fields are first in ascending order.
+func SortDocuments(docs []bson.M, sortFields bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, e := range sortFields {
+			a, _ := lookupField(docs[i], e.Key)
+			b, _ := lookupField(docs[j], e.Key)
+			c, _ := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if d, ok := e.Value.(int); ok && d < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func MatchQuery(doc bson.M, query bson.M) bool {
+	for key, condition := range query {
+		switch key {
+		case "$or":
+			matched := false
+			for _, q := range toArray(condition) {
+				if sub, ok := toMap(q); ok && MatchQuery(doc, sub) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		case "$and":
+			for _, q := range toArray(condition) {
+				if sub, ok := toMap(q); !ok || !MatchQuery(doc, sub) {
+					return false
+				}
+			}
+		default:
+			v, exist := lookupField(doc, key)
+			if !matchCondition(v, exist, condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchCondition(v interface{}, exist bool, condition interface{}) bool {
+	if regex, ok := condition.(primitive.Regex); ok {
+		return matchRegex(v, regex)
+	}
+	if operators, ok := toMap(condition); ok && isOperatorMap(operators) {
+		for op, operand := range operators {
+			if !matchOperator(v, exist, op, operand) {
+				return false
+			}
+		}
+		return true
+	}
+	return matchEqual(v, exist, condition)
+}
+
+func matchOperator(v interface{}, exist bool, op string, operand interface{}) bool {
+	switch op {
+	case "$eq":
+		return matchEqual(v, exist, operand)
+	case "$ne":
+		return !matchEqual(v, exist, operand)
+	case "$in":
+		for _, x := range toArray(operand) {
+			if matchCondition(v, exist, x) {
+				return true
+			}
+		}
+		return false
+	case "$nin":
+		for _, x := range toArray(operand) {
+			if matchCondition(v, exist, x) {
+				return false
+			}
+		}
+		return true
+	case "$exists":
+		b, _ := operand.(bool)
+		return exist == b
+	case "$regex":
+		if pattern, ok := operand.(string); ok {
+			return matchRegex(v, primitive.Regex{Pattern: pattern})
+		}
+		return false
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exist {
+			return false
+		}
+		c, ok := compareValues(v, operand)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+	log.Println("memory collection does not support " + op)
+	return false
+}
+
+func matchEqual(v interface{}, exist bool, x interface{}) bool {
+	x = plainValue(x)
+	if x == nil {
+		return !exist || v == nil
+	}
+	if equalValues(v, x) {
+		return true
+	}
+	if arr, ok := v.(bson.A); ok {
+		for _, item := range arr {
+			if equalValues(item, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchRegex(v interface{}, regex primitive.Regex) bool {
+	s, ok := v.(string)
+	if !ok {
+		if arr, ok1 := v.(bson.A); ok1 {
+			for _, item := range arr {
+				if matchRegex(item, regex) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	pattern := regex.Pattern
+	if strings.Contains(regex.Options, "i") {
+		pattern = "(?i)" + pattern
+	}
+	matched, err := regexp.MatchString(pattern, s)
+	return err == nil && matched
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupField(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := toMap(current)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,302 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector collects the pool and command metrics of the clients, and exports them in the Prometheus text format.
+// The driver does not publish the start of a checkout, so the pool wait is measured as the time the pool is exhausted,
+// which is when all connections, up to the max pool size, are checked out.
+type Collector struct {
+	Namespace string
+	Buckets   []float64
+	mu        sync.Mutex
+	pools     map[string]*poolStats
+	commands  map[commandKey]*histogram
+	errors    map[commandKey]int64
+	pending   sync.Map
+}
+
+type commandKey struct {
+	command    string
+	collection string
+}
+
+type poolStats struct {
+	maxSize     uint64
+	open        int64
+	checkedOut  int64
+	created     int64
+	closed      int64
+	failures    map[string]int64
+	exhausted   time.Duration
+	exhaustedAt time.Time
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func NewCollector(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	} else {
+		buckets = append([]float64(nil), buckets...)
+		sort.Float64s(buckets)
+	}
+	return &Collector{
+		Namespace: "mongo",
+		Buckets:   buckets,
+		pools:     make(map[string]*poolStats),
+		commands:  make(map[commandKey]*histogram),
+		errors:    make(map[commandKey]int64),
+	}
+}
+
+// WithCollector installs the pool and command monitors of c, keeping the monitors already set.
+func WithCollector(c *Collector) ClientOption {
+	return func(option *options.ClientOptions) {
+		WithPoolMonitor(c.PoolMonitor())(option)
+		WithCommandMonitor(c.CommandMonitor())(option)
+	}
+}
+
+func (c *Collector) PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: c.poolEvent}
+}
+
+func (c *Collector) CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			c.pending.Store(requestKey(e.ConnectionID, e.RequestID), commandKey{command: e.CommandName, collection: commandCollection(e.CommandName, e.Command)})
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			c.finish(e.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			c.finish(e.CommandFinishedEvent, true)
+		},
+	}
+}
+
+func requestKey(connectionId string, requestId int64) string {
+	return connectionId + "/" + strconv.FormatInt(requestId, 10)
+}
+
+func (c *Collector) finish(e event.CommandFinishedEvent, failed bool) {
+	key := commandKey{command: e.CommandName}
+	if v, ok := c.pending.LoadAndDelete(requestKey(e.ConnectionID, e.RequestID)); ok {
+		key = v.(commandKey)
+	}
+	seconds := time.Duration(e.DurationNanos).Seconds()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.commands[key]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(c.Buckets))}
+		c.commands[key] = h
+	}
+	for i, b := range c.Buckets {
+		if seconds <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+	if failed {
+		c.errors[key]++
+	}
+}
+
+func (c *Collector) poolEvent(e *event.PoolEvent) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pools[e.Address]
+	if !ok {
+		p = &poolStats{failures: make(map[string]int64)}
+		c.pools[e.Address] = p
+	}
+	switch e.Type {
+	case event.PoolCreated:
+		if e.PoolOptions != nil {
+			p.maxSize = e.PoolOptions.MaxPoolSize
+		}
+	case event.ConnectionCreated:
+		p.open++
+		p.created++
+	case event.ConnectionClosed:
+		if p.open > 0 {
+			p.open--
+		}
+		p.closed++
+	case event.GetSucceeded:
+		p.checkedOut++
+	case event.ConnectionReturned:
+		if p.checkedOut > 0 {
+			p.checkedOut--
+		}
+	case event.GetFailed:
+		p.failures[e.Reason]++
+	case event.PoolClosedEvent:
+		// on PoolCleared, the connections in use are still checked in later, so only a closed pool is reset
+		p.checkedOut = 0
+	}
+	exhausted := p.maxSize > 0 && p.checkedOut >= int64(p.maxSize)
+	if exhausted && p.exhaustedAt.IsZero() {
+		p.exhaustedAt = now
+	} else if !exhausted && !p.exhaustedAt.IsZero() {
+		p.exhausted += now.Sub(p.exhaustedAt)
+		p.exhaustedAt = time.Time{}
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	now := time.Now()
+	ns := c.Namespace
+	if len(ns) > 0 {
+		ns = ns + "_"
+	}
+	var b strings.Builder
+	c.mu.Lock()
+	addresses := make([]string, 0, len(c.pools))
+	for a := range c.pools {
+		addresses = append(addresses, a)
+	}
+	sort.Strings(addresses)
+	writeHeader(&b, ns+"pool_connections_open", "gauge", "Open connections of the pool.")
+	for _, a := range addresses {
+		writeSample(&b, ns+"pool_connections_open", labels("address", a), float64(c.pools[a].open))
+	}
+	writeHeader(&b, ns+"pool_connections_checked_out", "gauge", "Connections checked out of the pool.")
+	for _, a := range addresses {
+		writeSample(&b, ns+"pool_connections_checked_out", labels("address", a), float64(c.pools[a].checkedOut))
+	}
+	writeHeader(&b, ns+"pool_connections_idle", "gauge", "Idle connections of the pool.")
+	for _, a := range addresses {
+		p := c.pools[a]
+		idle := p.open - p.checkedOut
+		if idle < 0 {
+			idle = 0
+		}
+		writeSample(&b, ns+"pool_connections_idle", labels("address", a), float64(idle))
+	}
+	writeHeader(&b, ns+"pool_connections_created_total", "counter", "Connections created by the pool.")
+	for _, a := range addresses {
+		writeSample(&b, ns+"pool_connections_created_total", labels("address", a), float64(c.pools[a].created))
+	}
+	writeHeader(&b, ns+"pool_connections_closed_total", "counter", "Connections closed by the pool.")
+	for _, a := range addresses {
+		writeSample(&b, ns+"pool_connections_closed_total", labels("address", a), float64(c.pools[a].closed))
+	}
+	writeHeader(&b, ns+"pool_checkout_failures_total", "counter", "Failed checkouts of the pool by reason.")
+	for _, a := range addresses {
+		p := c.pools[a]
+		reasons := make([]string, 0, len(p.failures))
+		for r := range p.failures {
+			reasons = append(reasons, r)
+		}
+		sort.Strings(reasons)
+		for _, r := range reasons {
+			writeSample(&b, ns+"pool_checkout_failures_total", labels("address", a, "reason", r), float64(p.failures[r]))
+		}
+	}
+	writeHeader(&b, ns+"pool_exhausted_seconds_total", "counter", "Time all connections of the pool are checked out, so that checkouts wait.")
+	for _, a := range addresses {
+		p := c.pools[a]
+		d := p.exhausted
+		if !p.exhaustedAt.IsZero() {
+			d += now.Sub(p.exhaustedAt)
+		}
+		writeSample(&b, ns+"pool_exhausted_seconds_total", labels("address", a), d.Seconds())
+	}
+
+	keys := make([]commandKey, 0, len(c.commands))
+	for k := range c.commands {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].command != keys[j].command {
+			return keys[i].command < keys[j].command
+		}
+		return keys[i].collection < keys[j].collection
+	})
+	name := ns + "command_duration_seconds"
+	writeHeader(&b, name, "histogram", "Duration of the commands by command and collection.")
+	for _, k := range keys {
+		h := c.commands[k]
+		for i, bucket := range c.Buckets {
+			writeSample(&b, name+"_bucket", labels("command", k.command, "collection", k.collection, "le", formatFloat(bucket)), float64(h.counts[i]))
+		}
+		writeSample(&b, name+"_bucket", labels("command", k.command, "collection", k.collection, "le", "+Inf"), float64(h.count))
+		writeSample(&b, name+"_sum", labels("command", k.command, "collection", k.collection), h.sum)
+		writeSample(&b, name+"_count", labels("command", k.command, "collection", k.collection), float64(h.count))
+	}
+	writeHeader(&b, ns+"command_errors_total", "counter", "Failed commands by command and collection.")
+	for _, k := range keys {
+		if n, ok := c.errors[k]; ok {
+			writeSample(&b, ns+"command_errors_total", labels("command", k.command, "collection", k.collection), float64(n))
+		}
+	}
+	c.mu.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+func writeHeader(b *strings.Builder, name string, typ string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(b *strings.Builder, name string, labels string, value float64) {
+	b.WriteString(name)
+	b.WriteString(labels)
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+}
+
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
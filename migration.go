@@ -0,0 +1,300 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrMigrationLocked = errors.New("migration is locked by another instance")
+
+const migrationLockId = "migration"
+
+type Migration struct {
+	Id          string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+type MigrationStatus struct {
+	Id          string     `json:"id" bson:"_id"`
+	Description string     `json:"description,omitempty" bson:"description,omitempty"`
+	Applied     bool       `json:"applied" bson:"-"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty" bson:"appliedAt,omitempty"`
+}
+
+// Migrator applies the migrations in the order of Migrations, and records the applied ids in Collection.
+// Apply and Rollback take a lock in LockCollection, so that only one instance migrates at a time.
+// The lock is extended while a migration runs, so a migration can run longer than LockTimeout.
+type Migrator struct {
+	Database       *mongo.Database
+	Collection     *mongo.Collection
+	LockCollection *mongo.Collection
+	Migrations     []Migration
+	Owner          string
+	LockTimeout    time.Duration
+}
+
+// NewMigrator creates a Migrator. options[0] is the name of the lock collection, the default is collectionName + "_lock".
+func NewMigrator(db *mongo.Database, collectionName string, migrations []Migration, options ...string) *Migrator {
+	lockCollection := collectionName + "_lock"
+	if len(options) > 0 && len(options[0]) > 0 {
+		lockCollection = options[0]
+	}
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	return &Migrator{
+		Database:       db,
+		Collection:     db.Collection(collectionName),
+		LockCollection: db.Collection(lockCollection),
+		Migrations:     migrations,
+		Owner:          owner,
+		LockTimeout:    10 * time.Minute,
+	}
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var applied []MigrationStatus
+	cursor, err := m.Collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &applied); err != nil {
+		return nil, err
+	}
+	appliedById := make(map[string]MigrationStatus)
+	for _, a := range applied {
+		appliedById[a.Id] = a
+	}
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Id: migration.Id, Description: migration.Description}
+		if a, ok := appliedById[migration.Id]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Plan returns the migrations that Apply would run.
+func (m *Migrator) Plan(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Migration, 0)
+	for i, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, m.Migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// Apply runs the pending migrations and returns the ids of the applied ones.
+// It stops at the first failed migration, which is not recorded, so it runs again next time.
+func (m *Migrator) Apply(ctx context.Context) ([]string, error) {
+	ids := make([]string, 0)
+	if err := m.lock(ctx); err != nil {
+		return ids, err
+	}
+	defer m.unlock(ctx)
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		return ids, err
+	}
+	for _, migration := range pending {
+		if migration.Up != nil {
+			if er1 := m.hold(ctx, migration.Up); er1 != nil {
+				return ids, fmt.Errorf("migration %s failed: %w", migration.Id, er1)
+			}
+		}
+		status := MigrationStatus{Id: migration.Id, Description: migration.Description}
+		now := time.Now()
+		status.AppliedAt = &now
+		if _, er2 := m.Collection.InsertOne(ctx, status); er2 != nil {
+			return ids, er2
+		}
+		ids = append(ids, migration.Id)
+		if er3 := m.lock(ctx); er3 != nil {
+			return ids, er3
+		}
+	}
+	return ids, nil
+}
+
+// Rollback runs Down of the last steps applied migrations, in reverse order, and returns their ids.
+func (m *Migrator) Rollback(ctx context.Context, steps int) ([]string, error) {
+	ids := make([]string, 0)
+	if err := m.lock(ctx); err != nil {
+		return ids, err
+	}
+	defer m.unlock(ctx)
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return ids, err
+	}
+	for i := len(statuses) - 1; i >= 0 && len(ids) < steps; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		migration := m.Migrations[i]
+		if migration.Down == nil {
+			return ids, fmt.Errorf("migration %s can not be rolled back", migration.Id)
+		}
+		if er1 := m.hold(ctx, migration.Down); er1 != nil {
+			return ids, fmt.Errorf("rollback of migration %s failed: %w", migration.Id, er1)
+		}
+		if _, er2 := m.Collection.DeleteOne(ctx, bson.M{"_id": migration.Id}); er2 != nil {
+			return ids, er2
+		}
+		ids = append(ids, migration.Id)
+	}
+	return ids, nil
+}
+
+// lock takes or extends the lock. The lock of a crashed instance can be taken after it expires.
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{"_id": migrationLockId, "$or": bson.A{bson.M{"owner": m.Owner}, bson.M{"expiredAt": bson.M{"$lt": now}}}}
+	update := bson.M{"$set": bson.M{"owner": m.Owner, "lockedAt": now, "expiredAt": now.Add(m.LockTimeout)}}
+	_, err := m.LockCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	return err
+}
+
+// hold runs step, and extends the lock every third of LockTimeout while step runs.
+// If the lock is lost, because another instance took it or it could not be extended before it expired, the context of step is canceled and ErrMigrationLocked is returned.
+func (m *Migrator) hold(ctx context.Context, step func(ctx context.Context, db *mongo.Database) error) error {
+	interval := m.LockTimeout / 3
+	if interval <= 0 {
+		return step(ctx, m.Database)
+	}
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	lost := make(chan error, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		extendedAt := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-stepCtx.Done():
+				return
+			case <-ticker.C:
+				err := m.lock(stepCtx)
+				if err == nil {
+					extendedAt = time.Now()
+					continue
+				}
+				if errors.Is(err, ErrMigrationLocked) || time.Since(extendedAt) >= m.LockTimeout {
+					lost <- err
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	err := step(stepCtx, m.Database)
+	close(done)
+	wg.Wait()
+	select {
+	case er1 := <-lost:
+		if errors.Is(er1, ErrMigrationLocked) {
+			return er1
+		}
+		return fmt.Errorf("%w: the lock could not be extended: %v", ErrMigrationLocked, er1)
+	default:
+		return err
+	}
+}
+
+func (m *Migrator) unlock(ctx context.Context) {
+	_, _ = m.LockCollection.DeleteOne(ctx, bson.M{"_id": migrationLockId, "owner": m.Owner})
+}
+
+// RewriteMaps reads the documents matching filter in batches, and patches them by PatchMaps with the documents returned by rewrite.
+// If rewrite returns nil, the document is not changed. It is safe to run again if rewrite is idempotent.
+func RewriteMaps(ctx context.Context, collection *mongo.Collection, filter bson.M, batchSize int, rewrite func(map[string]interface{}) (map[string]interface{}, error)) (int64, error) {
+	return copyMaps(ctx, collection, filter, batchSize, rewrite, func(ctx context.Context, maps []map[string]interface{}) (*mongo.BulkWriteResult, error) {
+		return PatchMaps(ctx, collection, maps, "_id")
+	})
+}
+
+// CopyMaps reads the documents matching filter in batches, and upserts the documents returned by rewrite into target, by UpsertMaps.
+func CopyMaps(ctx context.Context, collection *mongo.Collection, target *mongo.Collection, filter bson.M, batchSize int, rewrite func(map[string]interface{}) (map[string]interface{}, error)) (int64, error) {
+	return copyMaps(ctx, collection, filter, batchSize, rewrite, func(ctx context.Context, maps []map[string]interface{}) (*mongo.BulkWriteResult, error) {
+		return UpsertMaps(ctx, target, maps, "_id")
+	})
+}
+
+func copyMaps(ctx context.Context, collection *mongo.Collection, filter bson.M, batchSize int, rewrite func(map[string]interface{}) (map[string]interface{}, error), write func(context.Context, []map[string]interface{}) (*mongo.BulkWriteResult, error)) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}).SetBatchSize(int32(batchSize)))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	var count int64
+	batch := make([]map[string]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		rs, er1 := write(ctx, batch)
+		if rs != nil {
+			count = count + rs.ModifiedCount + rs.UpsertedCount + rs.InsertedCount
+		}
+		batch = batch[:0]
+		return er1
+	}
+	for cursor.Next(ctx) {
+		doc := make(map[string]interface{})
+		if er2 := cursor.Decode(&doc); er2 != nil {
+			return count, er2
+		}
+		id := doc["_id"]
+		row, er3 := rewrite(doc)
+		if er3 != nil {
+			return count, er3
+		}
+		if row == nil {
+			continue
+		}
+		if _, ok := row["_id"]; !ok {
+			row["_id"] = id
+		}
+		batch = append(batch, row)
+		if len(batch) >= batchSize {
+			if er4 := flush(); er4 != nil {
+				return count, er4
+			}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
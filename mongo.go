@@ -11,6 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/x/bsonx"
 	"log"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -214,6 +215,17 @@ func FindAndDecode(ctx context.Context, collection *mongo.Collection, query bson
 	return true, er2
 }
 
+func ExistByQuery(ctx context.Context, collection *mongo.Collection, query bson.M) (bool, error) {
+	x := collection.FindOne(ctx, query, options.FindOne().SetProjection(bson.M{"_id": 1}))
+	if x.Err() != nil {
+		if fmt.Sprint(x.Err()) == "mongo: no documents in result" {
+			return false, nil
+		}
+		return false, x.Err()
+	}
+	return true, nil
+}
+
 func Exist(ctx context.Context, collection *mongo.Collection, id interface{}, objectId bool) (bool, error) {
 	query := bson.M{"_id": id}
 	if objectId {
@@ -245,12 +257,7 @@ func DeleteOne(ctx context.Context, coll *mongo.Collection, query bson.M) (int64
 func InsertOne(ctx context.Context, collection *mongo.Collection, model interface{}) (int64, error) {
 	result, err := collection.InsertOne(ctx, model)
 	if err != nil {
-		errMsg := err.Error()
-		if strings.Index(errMsg, "duplicate key error collection:") >= 0 {
-			return 0, nil
-		} else {
-			return 0, err
-		}
+		return 0, ToDuplicateKeyError(err)
 	} else {
 		if idValue, ok := result.InsertedID.(primitive.ObjectID); ok {
 			valueOfModel := reflect.Indirect(reflect.ValueOf(model))
@@ -265,20 +272,7 @@ func InsertOne(ctx context.Context, collection *mongo.Collection, model interfac
 }
 
 func InsertOneWithVersion(ctx context.Context, collection *mongo.Collection, model interface{}, versionIndex int) (int64, error) {
-	var defaultVersion interface{}
-	modelType := reflect.TypeOf(model).Elem()
-	versionType := modelType.Field(versionIndex).Type
-	switch versionType.String() {
-	case "int":
-		defaultVersion = int(1)
-	case "int32":
-		defaultVersion = int32(1)
-	case "int64":
-		defaultVersion = int64(1)
-	default:
-		panic("not support type's version")
-	}
-	model, err := setValue(model, versionIndex, defaultVersion)
+	model, err := setDefaultVersion(model, versionIndex)
 	if err != nil {
 		return 0, err
 	}
@@ -299,11 +293,8 @@ func InsertMany(ctx context.Context, collection *mongo.Collection, models interf
 	if len(arr) > 0 {
 		res, err := collection.InsertMany(ctx, arr)
 		if err != nil {
-			if strings.Index(err.Error(), "duplicate key error collection:") >= 0 {
-				return true, nil
-			} else {
-				return false, err
-			}
+			err = ToDuplicateKeyError(err)
+			return errors.Is(err, ErrDuplicateKey), err
 		}
 
 		valueOfModel := reflect.Indirect(reflect.ValueOf(arr[0]))
@@ -366,7 +357,7 @@ func InsertManySkipErrors(ctx context.Context, collection *mongo.Collection, mod
 			if rs != nil && len(idName) > 0 {
 				insertedSuccess = mapIdInObjects(models, indexFailArr, rs.InsertedIDs, modelsType, idName)
 			}
-			return insertedSuccess, insertedFails, err
+			return insertedSuccess, insertedFails, ToDuplicateKeyError(err)
 		} else {
 			for i := 0; i < values.Len(); i++ {
 				appendToArray(insertedFails, values.Index(i).Interface())
@@ -428,19 +419,25 @@ func existInArray(arr []int, value interface{}) bool {
 	return false
 }
 
-func Update(ctx context.Context, collection *mongo.Collection, model interface{}, fieldname string) error {
+// Update updates the document of model by id. The omitted fields, such as createdBy and createdAt, are not updated.
+func Update(ctx context.Context, collection *mongo.Collection, model interface{}, fieldname string, omit ...string) error {
 	query := BuildQueryId(model, fieldname)
 	defaultObjID, _ := primitive.ObjectIDFromHex("000000000000")
 	if idValue := query["_id"]; !(idValue == "" || idValue == 0 || idValue == defaultObjID) {
-		_, err := UpdateOne(ctx, collection, model, query)
+		_, err := UpdateOne(ctx, collection, model, query, omit...)
 		return err
 	}
 	return errors.New("require field _id")
 }
 
-func UpdateOne(ctx context.Context, collection *mongo.Collection, model interface{}, query bson.M) (int64, error) { //Patch
+// UpdateOne sets the fields of model to the document of query. The omitted fields are not updated.
+func UpdateOne(ctx context.Context, collection *mongo.Collection, model interface{}, query bson.M, omit ...string) (int64, error) { //Patch
+	doc, er0 := omitFields(model, omit)
+	if er0 != nil {
+		return 0, er0
+	}
 	updateQuery := bson.M{
-		"$set": model,
+		"$set": doc,
 	}
 	result, err := collection.UpdateOne(ctx, query, updateQuery)
 	if result.ModifiedCount > 0 {
@@ -452,7 +449,13 @@ func UpdateOne(ctx context.Context, collection *mongo.Collection, model interfac
 	}
 }
 
-func UpdateMany(ctx context.Context, collection *mongo.Collection, models interface{}, idName string) (*mongo.BulkWriteResult, error) {
+// UpdateMany updates the documents of the models by id, by an ordered bulk write. The omitted fields are not updated.
+func UpdateMany(ctx context.Context, collection *mongo.Collection, models interface{}, idName string, omit ...string) (*mongo.BulkWriteResult, error) {
+	return UpdateManyWithOptions(ctx, collection, models, idName, nil, omit...)
+}
+
+// UpdateManyWithOptions is the same as UpdateMany, with the options of the bulk write, such as Ordered.
+func UpdateManyWithOptions(ctx context.Context, collection *mongo.Collection, models interface{}, idName string, opts *options.BulkWriteOptions, omit ...string) (*mongo.BulkWriteResult, error) {
 	models_ := make([]mongo.WriteModel, 0)
 	if reflect.TypeOf(models).Kind() == reflect.Slice {
 		values := reflect.ValueOf(models)
@@ -465,8 +468,12 @@ func UpdateMany(ctx context.Context, collection *mongo.Collection, models interf
 					if er0 != nil {
 						return nil, er0
 					}
+					doc, er1 := omitFields(row, omit)
+					if er1 != nil {
+						return nil, er1
+					}
 					updateQuery := bson.M{
-						"$set": row,
+						"$set": doc,
 					}
 					updateModel := mongo.NewUpdateOneModel().SetUpdate(updateQuery).SetFilter(bson.M{"_id": v})
 					models_ = append(models_, updateModel)
@@ -474,10 +481,144 @@ func UpdateMany(ctx context.Context, collection *mongo.Collection, models interf
 			}
 		}
 	}
-	res, err := collection.BulkWrite(ctx, models_)
+	res, err := collection.BulkWrite(ctx, models_, opts)
 	return res, err
 }
 
+// UpdateManyWithVersion updates the models by id and version, by an ordered bulk write, and returns the indices of the models which are not updated.
+// The error is ErrVersionConflict if the failed models do not exist or have another version, a BulkWriteException if some models have write errors,
+// or the error which stopped the bulk write, then all models are failed. The omitted fields are not updated.
+// The version of the models, which are not updated, is restored, so that they can be written again, such as by RetryPolicy.
+func UpdateManyWithVersion(ctx context.Context, collection *mongo.Collection, models interface{}, idName string, versionIndex int, omit ...string) (*mongo.BulkWriteResult, []int, error) {
+	return UpdateManyWithVersionAndOptions(ctx, collection, models, idName, versionIndex, nil, omit...)
+}
+
+// UpdateManyWithVersionAndOptions is the same as UpdateManyWithVersion, with the options of the bulk write, such as Ordered.
+func UpdateManyWithVersionAndOptions(ctx context.Context, collection *mongo.Collection, models interface{}, idName string, versionIndex int, opts *options.BulkWriteOptions, omit ...string) (*mongo.BulkWriteResult, []int, error) {
+	values := reflect.Indirect(reflect.ValueOf(models))
+	length := values.Len()
+	if length == 0 {
+		return &mongo.BulkWriteResult{}, nil, nil
+	}
+	idIndex := findIndex(values.Index(0).Interface(), idName)
+	if idIndex < 0 {
+		return nil, nil, fmt.Errorf("cannot find field %s", idName)
+	}
+	var versionName string
+	ids := make([]interface{}, length)
+	versions := make([]reflect.Value, length)
+	previous := make([]reflect.Value, length)
+	writeModels := make([]mongo.WriteModel, 0, length)
+	restore := func(failIndices []int) {
+		for _, i := range failIndices {
+			if versions[i].IsValid() {
+				versions[i].Set(previous[i])
+			}
+		}
+	}
+	for i := 0; i < length; i++ {
+		row := values.Index(i)
+		if row.Kind() != reflect.Ptr {
+			row = row.Addr()
+		}
+		model := row.Interface()
+		id, er0 := getValue(model, idIndex)
+		if er0 != nil {
+			restore(indices(0, i))
+			return nil, indices(0, length), er0
+		}
+		ids[i] = id
+		if i == 0 {
+			versionName = GetBsonNameByModelIndex(model, versionIndex)
+		}
+		versions[i] = reflect.Indirect(row).Field(versionIndex)
+		previous[i] = reflect.ValueOf(versions[i].Interface())
+		versionQuery, er1 := buildIdAndVersionQuery(bson.M{"_id": id}, model, versionIndex)
+		if er1 != nil {
+			restore(indices(0, i))
+			return nil, indices(0, length), er1
+		}
+		doc, er2 := omitFields(model, omit)
+		if er2 != nil {
+			restore(indices(0, i+1))
+			return nil, indices(0, length), er2
+		}
+		writeModels = append(writeModels, mongo.NewUpdateOneModel().SetFilter(versionQuery).SetUpdate(bson.M{"$set": doc}))
+	}
+	ordered := opts == nil || opts.Ordered == nil || *opts.Ordered
+	res, err := collection.BulkWrite(ctx, writeModels, opts)
+	var bulkWriteException mongo.BulkWriteException
+	if err != nil && !errors.As(err, &bulkWriteException) {
+		restore(indices(0, length))
+		return res, indices(0, length), err
+	}
+	successIndices, failIndices := BulkWriteIndices(length, err, ordered)
+	if res == nil {
+		res = &mongo.BulkWriteResult{}
+	}
+	if res.MatchedCount < int64(len(successIndices)) {
+		// some models are not matched by their id and version: the documents, which do not have the next version of their models, are not updated
+		updated, er3 := findUpdatedIndices(ctx, collection, successIndices, ids, versions, versionName)
+		if er3 != nil {
+			restore(indices(0, length))
+			return res, indices(0, length), er3
+		}
+		conflicts := make([]int, 0)
+		for _, i := range successIndices {
+			if !updated[i] {
+				conflicts = append(conflicts, i)
+			}
+		}
+		failIndices = append(failIndices, conflicts...)
+		sort.Ints(failIndices)
+		restore(failIndices)
+		if err == nil && len(conflicts) > 0 {
+			err = ErrVersionConflict
+		}
+		return res, failIndices, err
+	}
+	restore(failIndices)
+	if err != nil {
+		return res, failIndices, err
+	}
+	return res, nil, nil
+}
+
+// findUpdatedIndices reads the documents of the ids at the positions, in one query, and returns the positions where the document has the version of versions.
+func findUpdatedIndices(ctx context.Context, collection *mongo.Collection, positions []int, ids []interface{}, versions []reflect.Value, versionName string) (map[int]bool, error) {
+	in := make([]interface{}, 0, len(positions))
+	for _, i := range positions {
+		in = append(in, ids[i])
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": in}}, options.Find().SetProjection(bson.M{"_id": 1, versionName: 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	updated := make(map[int]bool)
+	for _, i := range positions {
+		for _, doc := range docs {
+			if equalValues(doc["_id"], ids[i]) && equalValues(doc[versionName], versions[i].Interface()) {
+				updated[i] = true
+				break
+			}
+		}
+	}
+	return updated, nil
+}
+
+// indices returns the integers from start to end, end excluded.
+func indices(start int, end int) []int {
+	list := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		list = append(list, i)
+	}
+	return list
+}
+
 func PatchOne(ctx context.Context, collection *mongo.Collection, model interface{}, query bson.M) (int64, error) {
 	updateQuery := bson.M{
 		"$set": model,
@@ -642,13 +783,14 @@ func BuildQueryId(model interface{}, fieldname string) bson.M {
 	}
 	return query
 }
-func Upsert(ctx context.Context, collection *mongo.Collection, model interface{}, fieldname string) error {
+func Upsert(ctx context.Context, collection *mongo.Collection, model interface{}, fieldname string, insertOnly ...string) error {
 	query := BuildQueryId(model, fieldname)
-	_, err := UpsertOne(ctx, collection, query, model)
+	_, err := UpsertOne(ctx, collection, query, model, insertOnly...)
 	return err
 }
 
-func UpsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M, model interface{}) (int64, error) {
+// UpsertOne inserts model, or updates the document if it exists. The insertOnly fields, such as createdBy and createdAt, are not updated.
+func UpsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M, model interface{}, insertOnly ...string) (int64, error) {
 	defaultObjID, _ := primitive.ObjectIDFromHex("000000000000")
 
 	if idValue := filter["_id"]; idValue == "" || idValue == 0 || idValue == defaultObjID {
@@ -659,8 +801,12 @@ func UpsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M,
 			return 0, err
 		}
 		if isExisted {
+			doc, er1 := omitFields(model, insertOnly)
+			if er1 != nil {
+				return 0, er1
+			}
 			update := bson.M{
-				"$set": model,
+				"$set": doc,
 			}
 			result := collection.FindOneAndUpdate(ctx, filter, update)
 			if result.Err() != nil {
@@ -677,7 +823,8 @@ func UpsertOne(ctx context.Context, collection *mongo.Collection, filter bson.M,
 	}
 }
 
-func UpsertOneWithVersion(ctx context.Context, collection *mongo.Collection, model interface{}, versionIndex int) (int64, error) {
+// UpsertOneWithVersion inserts model, or updates the document by id and version if it exists. The insertOnly fields are not updated.
+func UpsertOneWithVersion(ctx context.Context, collection *mongo.Collection, model interface{}, versionIndex int, insertOnly ...string) (int64, error) {
 	idQuery := BuildQueryByIdFromObject(model)
 	defaultObjID, _ := primitive.ObjectIDFromHex("000000000000")
 
@@ -689,14 +836,21 @@ func UpsertOneWithVersion(ctx context.Context, collection *mongo.Collection, mod
 			return 0, err
 		}
 		if isExisted {
-			versionQuery := BuildIdAndVersionQueryByVersionIndex(idQuery, model, versionIndex)
+			versionQuery, er1 := buildIdAndVersionQuery(idQuery, model, versionIndex)
+			if er1 != nil {
+				return 0, er1
+			}
+			doc, er2 := omitFields(model, insertOnly)
+			if er2 != nil {
+				return 0, er2
+			}
 			update := bson.M{
-				"$set": model,
+				"$set": doc,
 			}
 			result := collection.FindOneAndUpdate(ctx, versionQuery, update)
 			if result.Err() != nil {
-				if fmt.Sprint(result.Err()) == "mongo: no documents in result" {
-					return -1, nil
+				if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+					return -1, ErrVersionConflict
 				} else {
 					return 0, result.Err()
 				}
@@ -708,7 +862,14 @@ func UpsertOneWithVersion(ctx context.Context, collection *mongo.Collection, mod
 	}
 }
 
-func UpsertMany(ctx context.Context, collection *mongo.Collection, model interface{}, idName string) (*mongo.BulkWriteResult, error) { //Patch
+// UpsertMany replaces the documents of the models, or inserts them, by an ordered bulk write. If there are insertOnly fields, the documents are updated by $set,
+// and the insertOnly fields by $setOnInsert, so that they are kept if the documents exist.
+func UpsertMany(ctx context.Context, collection *mongo.Collection, model interface{}, idName string, insertOnly ...string) (*mongo.BulkWriteResult, error) { //Patch
+	return UpsertManyWithOptions(ctx, collection, model, idName, nil, insertOnly...)
+}
+
+// UpsertManyWithOptions is the same as UpsertMany, with the options of the bulk write, such as Ordered.
+func UpsertManyWithOptions(ctx context.Context, collection *mongo.Collection, model interface{}, idName string, opts *options.BulkWriteOptions, insertOnly ...string) (*mongo.BulkWriteResult, error) {
 	models := make([]mongo.WriteModel, 0)
 	switch reflect.TypeOf(model).Kind() {
 	case reflect.Slice:
@@ -724,6 +885,14 @@ func UpsertMany(ctx context.Context, collection *mongo.Collection, model interfa
 						return nil, er0
 					}
 					if id != nil || (reflect.TypeOf(id).String() == "string") || (reflect.TypeOf(id).String() == "string" && len(id.(string)) > 0) { // if exist
+						if len(insertOnly) > 0 {
+							update, er1 := buildUpsert(row, insertOnly)
+							if er1 != nil {
+								return nil, er1
+							}
+							models = append(models, mongo.NewUpdateOneModel().SetUpsert(true).SetUpdate(update).SetFilter(bson.M{"_id": id}))
+							continue
+						}
 						updateModel := mongo.NewReplaceOneModel().SetUpsert(true).SetReplacement(row).SetFilter(bson.M{"_id": id})
 						models = append(models, updateModel)
 					} else {
@@ -734,10 +903,69 @@ func UpsertMany(ctx context.Context, collection *mongo.Collection, model interfa
 			}
 		}
 	}
-	rs, err := collection.BulkWrite(ctx, models)
+	rs, err := collection.BulkWrite(ctx, models, opts)
 	return rs, err
 }
 
+// omitFields returns the document of model without the fields.
+func omitFields(model interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return model, nil
+	}
+	set, _, err := splitFields(model, fields)
+	return set, err
+}
+
+// buildUpsert returns the update of an upsert, which sets the fields only when the document is inserted.
+func buildUpsert(model interface{}, insertOnly []string) (bson.M, error) {
+	set, setOnInsert, err := splitFields(model, append([]string{"_id"}, insertOnly...))
+	if err != nil {
+		return nil, err
+	}
+	// _id is set by the filter when the document is inserted
+	for i, e := range setOnInsert {
+		if e.Key == "_id" {
+			setOnInsert = append(setOnInsert[:i], setOnInsert[i+1:]...)
+			break
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(setOnInsert) > 0 {
+		update["$setOnInsert"] = setOnInsert
+	}
+	return update, nil
+}
+
+func splitFields(model interface{}, fields []string) (bson.D, bson.D, error) {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	others := make(bson.D, 0, len(doc))
+	selected := make(bson.D, 0, len(fields))
+	for _, e := range doc {
+		if containsString(fields, e.Key) {
+			selected = append(selected, e)
+		} else {
+			others = append(others, e)
+		}
+	}
+	return others, selected, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func UpdateMaps(ctx context.Context, collection *mongo.Collection, maps []map[string]interface{}, idName string) (*mongo.BulkWriteResult, error) {
 	if idName == "" {
 		idName = "_id"
@@ -757,6 +985,11 @@ func UpdateMaps(ctx context.Context, collection *mongo.Collection, maps []map[st
 }
 
 func PatchMaps(ctx context.Context, collection *mongo.Collection, maps []map[string]interface{}, idName string) (*mongo.BulkWriteResult, error) {
+	return PatchMapsWithOptions(ctx, collection, maps, idName, nil)
+}
+
+// PatchMapsWithOptions is the same as PatchMaps, with the options of the bulk write, such as Ordered.
+func PatchMapsWithOptions(ctx context.Context, collection *mongo.Collection, maps []map[string]interface{}, idName string, opts *options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
 	if idName == "" {
 		idName = "_id"
 	}
@@ -770,7 +1003,7 @@ func PatchMaps(ctx context.Context, collection *mongo.Collection, maps []map[str
 			writeModels = append(writeModels, updateModel)
 		}
 	}
-	res, err := collection.BulkWrite(ctx, writeModels)
+	res, err := collection.BulkWrite(ctx, writeModels, opts)
 	return res, err
 }
 
@@ -792,6 +1025,35 @@ func UpsertMaps(ctx context.Context, collection *mongo.Collection, maps []map[st
 	return res, err
 }
 
+// BulkWriteIndices returns the success and fail indices of a bulk write of length models, which returns err.
+// If the bulk write is ordered, it stops at the first write error, so the models after it are failed too.
+func BulkWriteIndices(length int, err error, ordered bool) ([]int, []int) {
+	successIndices := make([]int, 0)
+	failIndices := make([]int, 0)
+	if err == nil {
+		return indices(0, length), failIndices
+	}
+	bulkWriteException, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		return successIndices, indices(0, length)
+	}
+	end := length
+	for _, writeError := range bulkWriteException.WriteErrors {
+		failIndices = append(failIndices, writeError.Index)
+		if ordered && writeError.Index < end {
+			end = writeError.Index
+		}
+	}
+	for i := 0; i < length; i++ {
+		if i > end {
+			failIndices = append(failIndices, i)
+		} else if !InArray(i, failIndices) {
+			successIndices = append(successIndices, i)
+		}
+	}
+	return successIndices, failIndices
+}
+
 func FindCoordinatesIndex(modelType reflect.Type) int {
 	numField := modelType.NumField()
 	for i := 0; i < numField; i++ {
@@ -1088,26 +1350,11 @@ func copyMap(originalMap map[string]interface{}) map[string]interface{} {
 	return newMap
 }
 
-func BuildIdAndVersionQueryByMap(query map[string]interface{}, v map[string]interface{}, maps map[string]string, versionField string) map[string]interface{} {
-	newMap := copyMap(query)
-	if currentVersion, exist := v[versionField]; exist {
-		newMap[maps[versionField]] = currentVersion
-		switch versionValue := currentVersion.(type) {
-		case int:
-			{
-				v[versionField] = versionValue + 1
-			}
-		case int32:
-			{
-				v[versionField] = versionValue + 1
-			}
-		case int64:
-			{
-				v[versionField] = versionValue + 1
-			}
-		default:
-			panic("not support type's version")
-		}
+// BuildIdAndVersionQueryByMap adds the version of v to query. The optional versionType is the type of the version field, to convert the version of v.
+func BuildIdAndVersionQueryByMap(query map[string]interface{}, v map[string]interface{}, maps map[string]string, versionField string, versionType ...reflect.Type) map[string]interface{} {
+	newMap, err := buildIdAndVersionQueryByMap(query, v, maps, versionField, firstType(versionType))
+	if err != nil {
+		panic(err)
 	}
 	return newMap
 }
@@ -1118,42 +1365,21 @@ func BuildIdAndVersionQuery(query map[string]interface{}, model interface{}, ver
 }
 
 func BuildIdAndVersionQueryByVersionIndex(query map[string]interface{}, model interface{}, versionIndex int) map[string]interface{} {
-	newMap := copyMap(query)
-	vo := reflect.Indirect(reflect.ValueOf(model))
-	if versionIndex >= 0 && versionIndex < vo.NumField() {
-		var valueOfCurrentVersion reflect.Value
-		valueOfCurrentVersion = vo.Field(versionIndex)
-		versionColumnName := GetBsonNameByModelIndex(model, versionIndex)
-		newMap[versionColumnName] = valueOfCurrentVersion.Interface()
-		switch valueOfCurrentVersion.Kind().String() {
-		case "int":
-			{
-				nextVersion := reflect.ValueOf(valueOfCurrentVersion.Interface().(int) + 1)
-				vo.Field(versionIndex).Set(nextVersion)
-			}
-		case "int32":
-			{
-				nextVersion := reflect.ValueOf(valueOfCurrentVersion.Interface().(int32) + 1)
-				vo.Field(versionIndex).Set(nextVersion)
-			}
-		case "int64":
-			{
-				nextVersion := reflect.ValueOf(valueOfCurrentVersion.Interface().(int64) + 1)
-				vo.Field(versionIndex).Set(nextVersion)
-			}
-		default:
-			panic("not support type's version")
-		}
-		return newMap
-	} else {
-		panic("invalid versionIndex")
+	newMap, err := buildIdAndVersionQuery(query, model, versionIndex)
+	if err != nil {
+		panic(err)
 	}
+	return newMap
 }
 
-func UpdateByIdAndVersion(ctx context.Context, collection *mongo.Collection, model interface{}, versionIndex int) (int64, error) {
+// UpdateByIdAndVersion updates the document of model by id and version, and sets the next version to model. The omitted fields are not updated.
+func UpdateByIdAndVersion(ctx context.Context, collection *mongo.Collection, model interface{}, versionIndex int, omit ...string) (int64, error) {
 	idQuery := BuildQueryByIdFromObject(model)
-	versionQuery := BuildIdAndVersionQueryByVersionIndex(idQuery, model, versionIndex)
-	rowAffect, er1 := UpdateOne(ctx, collection, model, versionQuery)
+	versionQuery, er0 := buildIdAndVersionQuery(idQuery, model, versionIndex)
+	if er0 != nil {
+		return 0, er0
+	}
+	rowAffect, er1 := UpdateOne(ctx, collection, model, versionQuery, omit...)
 	if er1 != nil {
 		return 0, er1
 	}
@@ -1163,17 +1389,21 @@ func UpdateByIdAndVersion(ctx context.Context, collection *mongo.Collection, mod
 			return 0, er2
 		}
 		if isExist {
-			return -1, nil
+			return -1, ErrVersionConflict
 		} else {
-			return 0, nil
+			return 0, ErrNotFound
 		}
 	}
 	return rowAffect, er1
 }
 
-func PatchByIdAndVersion(ctx context.Context, collection *mongo.Collection, model map[string]interface{}, maps map[string]string, idName string, versionField string) (int64, error) {
+// PatchByIdAndVersion patches model by id and version. The optional versionType is the type of the version field, to convert the version of model.
+func PatchByIdAndVersion(ctx context.Context, collection *mongo.Collection, model map[string]interface{}, maps map[string]string, idName string, versionField string, versionType ...reflect.Type) (int64, error) {
 	idQuery := BuildQueryByIdFromMap(model, idName)
-	versionQuery := BuildIdAndVersionQueryByMap(idQuery, model, maps, versionField)
+	versionQuery, er0 := buildIdAndVersionQueryByMap(idQuery, model, maps, versionField, firstType(versionType))
+	if er0 != nil {
+		return 0, er0
+	}
 	b := MapToBson(model, maps)
 	rowAffect, er1 := PatchOne(ctx, collection, b, versionQuery)
 	if er1 != nil {
@@ -1185,13 +1415,20 @@ func PatchByIdAndVersion(ctx context.Context, collection *mongo.Collection, mode
 			return 0, er2
 		}
 		if isExist {
-			return -1, nil
+			return -1, ErrVersionConflict
 		}
-		return 0, nil
+		return 0, ErrNotFound
 	}
 	return rowAffect, er1
 }
 
+func firstType(types []reflect.Type) reflect.Type {
+	if len(types) > 0 {
+		return types[0]
+	}
+	return nil
+}
+
 func InArray(value int, arr []int) bool {
 	for i := 0; i < len(arr); i++ {
 		if value == arr[i] {
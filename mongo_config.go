@@ -1,27 +1,63 @@
 package mongo
 
 type MongoConfig struct {
-	Uri                      string            `mapstructure:"uri" json:"uri,omitempty" gorm:"column:uri" bson:"uri,omitempty" dynamodbav:"uri,omitempty" firestore:"uri,omitempty"`
-	Database                 string            `mapstructure:"database" json:"database,omitempty" gorm:"column:database" bson:"database,omitempty" dynamodbav:"database,omitempty" firestore:"database,omitempty"`
-	AuthSource               string            `mapstructure:"auth_source" json:"authSource,omitempty" gorm:"column:authSource" bson:"authSource,omitempty" dynamodbav:"authSource,omitempty" firestore:"authSource,omitempty"`
-	ReplicaSet               string            `mapstructure:"replica_set" json:"replicaSet,omitempty" gorm:"column:replicaSet" bson:"replicaSet,omitempty" dynamodbav:"replicaSet,omitempty" firestore:"replicaSet,omitempty"`
-	Credential               *CredentialConfig `mapstructure:"credential" json:"credential,omitempty" gorm:"column:credential" bson:"credential,omitempty" dynamodbav:"credential,omitempty" firestore:"credential,omitempty"`
-	Compressors              []string          `mapstructure:"compressors" json:"compressors,omitempty" gorm:"column:compressors" bson:"compressors,omitempty" dynamodbav:"compressors,omitempty" firestore:"compressors,omitempty"`
-	Hosts                    []string          `mapstructure:"hosts" json:"hosts,omitempty" gorm:"column:hosts" bson:"hosts,omitempty" dynamodbav:"hosts,omitempty" firestore:"hosts,omitempty"`
-	RetryReads               *bool             `mapstructure:"retry_reads" json:"retryReads,omitempty" gorm:"column:retryReads" bson:"retryReads,omitempty" dynamodbav:"retryReads,omitempty" firestore:"retryReads,omitempty"`
-	RetryWrites              *bool             `mapstructure:"retry_writes" json:"retryWrites,omitempty" gorm:"column:retrywrites" bson:"retryWrites,omitempty" dynamodbav:"retryWrites,omitempty" firestore:"retryWrites,omitempty"`
-	AppName                  string            `mapstructure:"app_name" json:"appName,omitempty" gorm:"column:appname" bson:"appName,omitempty" dynamodbav:"appName,omitempty" firestore:"appName,omitempty"`
-	MaxPoolSize              uint64            `mapstructure:"max_pool_size" json:"maxPoolSize,omitempty" gorm:"column:maxpoolsize" bson:"maxPoolSize,omitempty" dynamodbav:"maxPoolSize,omitempty" firestore:"maxPoolSize,omitempty"`
-	MinPoolSize              uint64            `mapstructure:"min_pool_size" json:"minPoolSize,omitempty" gorm:"column:minpoolsize" bson:"minPoolSize,omitempty" dynamodbav:"minPoolSize,omitempty" firestore:"minPoolSize,omitempty"`
-	ConnectTimeout           int64             `mapstructure:"connect_timeout" json:"connectTimeout,omitempty" gorm:"column:connecttimeout" bson:"connectTimeout,omitempty" dynamodbav:"connectTimeout,omitempty" firestore:"connectTimeout,omitempty"`
-	SocketTimeout            int64             `mapstructure:"socket_timeout" json:"socketTimeout,omitempty" gorm:"column:sockettimeout" bson:"socketTimeout,omitempty" dynamodbav:"socketTimeout,omitempty" firestore:"socketTimeout,omitempty"`
-	ServerSelectionTimeout   int64             `mapstructure:"server_selection_timeout" json:"serverSelectionTimeout,omitempty" gorm:"column:serverselectiontimeout" bson:"serverSelectionTimeout,omitempty" dynamodbav:"serverSelectionTimeout,omitempty" firestore:"serverSelectionTimeout,omitempty"`
-	LocalThreshold           int64             `mapstructure:"local_threshold" json:"localThreshold,omitempty" gorm:"column:localthreshold" bson:"localThreshold,omitempty" dynamodbav:"localThreshold,omitempty" firestore:"localThreshold,omitempty"`
-	HeartbeatInterval        int64             `mapstructure:"heartbeat_interval" json:"heartbeatInterval,omitempty" gorm:"column:heartbeatinterval" bson:"heartbeatInterval,omitempty" dynamodbav:"heartbeatInterval,omitempty" firestore:"heartbeatInterval,omitempty"`
-	ZlibLevel                int               `mapstructure:"zlibLevel" json:"zlibLevel,omitempty" gorm:"column:zlibLevel" bson:"zlibLevel,omitempty" dynamodbav:"zlibLevel,omitempty" firestore:"zlibLevel,omitempty"`
-	MaxConnIdleTime          int64             `mapstructure:"max_conn_idle_time" json:"maxConnIdleTime,omitempty" gorm:"column:maxconnidletime" bson:"maxConnIdleTime,omitempty" dynamodbav:"maxConnIdleTime,omitempty" firestore:"maxConnIdleTime,omitempty"`
-	DisableOCSPEndpointCheck *bool             `mapstructure:"disable_ocsp_endpoint_check" json:"disableOCSPEndpointCheck,omitempty" gorm:"column:disableocspendpointcheck" bson:"disableOCSPEndpointCheck,omitempty" dynamodbav:"disableOCSPEndpointCheck,omitempty" firestore:"disableOCSPEndpointCheck,omitempty"`
-	Direct                   *bool             `mapstructure:"direct" json:"direct,omitempty" gorm:"column:direct" bson:"direct,omitempty" dynamodbav:"direct,omitempty" firestore:"direct,omitempty"`
+	Uri                      string                `mapstructure:"uri" json:"uri,omitempty" gorm:"column:uri" bson:"uri,omitempty" dynamodbav:"uri,omitempty" firestore:"uri,omitempty"`
+	Database                 string                `mapstructure:"database" json:"database,omitempty" gorm:"column:database" bson:"database,omitempty" dynamodbav:"database,omitempty" firestore:"database,omitempty"`
+	AuthSource               string                `mapstructure:"auth_source" json:"authSource,omitempty" gorm:"column:authSource" bson:"authSource,omitempty" dynamodbav:"authSource,omitempty" firestore:"authSource,omitempty"`
+	ReplicaSet               string                `mapstructure:"replica_set" json:"replicaSet,omitempty" gorm:"column:replicaSet" bson:"replicaSet,omitempty" dynamodbav:"replicaSet,omitempty" firestore:"replicaSet,omitempty"`
+	Credential               *CredentialConfig     `mapstructure:"credential" json:"credential,omitempty" gorm:"column:credential" bson:"credential,omitempty" dynamodbav:"credential,omitempty" firestore:"credential,omitempty"`
+	Compressors              []string              `mapstructure:"compressors" json:"compressors,omitempty" gorm:"column:compressors" bson:"compressors,omitempty" dynamodbav:"compressors,omitempty" firestore:"compressors,omitempty"`
+	Hosts                    []string              `mapstructure:"hosts" json:"hosts,omitempty" gorm:"column:hosts" bson:"hosts,omitempty" dynamodbav:"hosts,omitempty" firestore:"hosts,omitempty"`
+	RetryReads               *bool                 `mapstructure:"retry_reads" json:"retryReads,omitempty" gorm:"column:retryReads" bson:"retryReads,omitempty" dynamodbav:"retryReads,omitempty" firestore:"retryReads,omitempty"`
+	RetryWrites              *bool                 `mapstructure:"retry_writes" json:"retryWrites,omitempty" gorm:"column:retrywrites" bson:"retryWrites,omitempty" dynamodbav:"retryWrites,omitempty" firestore:"retryWrites,omitempty"`
+	AppName                  string                `mapstructure:"app_name" json:"appName,omitempty" gorm:"column:appname" bson:"appName,omitempty" dynamodbav:"appName,omitempty" firestore:"appName,omitempty"`
+	MaxPoolSize              uint64                `mapstructure:"max_pool_size" json:"maxPoolSize,omitempty" gorm:"column:maxpoolsize" bson:"maxPoolSize,omitempty" dynamodbav:"maxPoolSize,omitempty" firestore:"maxPoolSize,omitempty"`
+	MinPoolSize              uint64                `mapstructure:"min_pool_size" json:"minPoolSize,omitempty" gorm:"column:minpoolsize" bson:"minPoolSize,omitempty" dynamodbav:"minPoolSize,omitempty" firestore:"minPoolSize,omitempty"`
+	ConnectTimeout           int64                 `mapstructure:"connect_timeout" json:"connectTimeout,omitempty" gorm:"column:connecttimeout" bson:"connectTimeout,omitempty" dynamodbav:"connectTimeout,omitempty" firestore:"connectTimeout,omitempty"`
+	SocketTimeout            int64                 `mapstructure:"socket_timeout" json:"socketTimeout,omitempty" gorm:"column:sockettimeout" bson:"socketTimeout,omitempty" dynamodbav:"socketTimeout,omitempty" firestore:"socketTimeout,omitempty"`
+	ServerSelectionTimeout   int64                 `mapstructure:"server_selection_timeout" json:"serverSelectionTimeout,omitempty" gorm:"column:serverselectiontimeout" bson:"serverSelectionTimeout,omitempty" dynamodbav:"serverSelectionTimeout,omitempty" firestore:"serverSelectionTimeout,omitempty"`
+	LocalThreshold           int64                 `mapstructure:"local_threshold" json:"localThreshold,omitempty" gorm:"column:localthreshold" bson:"localThreshold,omitempty" dynamodbav:"localThreshold,omitempty" firestore:"localThreshold,omitempty"`
+	HeartbeatInterval        int64                 `mapstructure:"heartbeat_interval" json:"heartbeatInterval,omitempty" gorm:"column:heartbeatinterval" bson:"heartbeatInterval,omitempty" dynamodbav:"heartbeatInterval,omitempty" firestore:"heartbeatInterval,omitempty"`
+	ZlibLevel                int                   `mapstructure:"zlibLevel" json:"zlibLevel,omitempty" gorm:"column:zlibLevel" bson:"zlibLevel,omitempty" dynamodbav:"zlibLevel,omitempty" firestore:"zlibLevel,omitempty"`
+	MaxConnIdleTime          int64                 `mapstructure:"max_conn_idle_time" json:"maxConnIdleTime,omitempty" gorm:"column:maxconnidletime" bson:"maxConnIdleTime,omitempty" dynamodbav:"maxConnIdleTime,omitempty" firestore:"maxConnIdleTime,omitempty"`
+	DisableOCSPEndpointCheck *bool                 `mapstructure:"disable_ocsp_endpoint_check" json:"disableOCSPEndpointCheck,omitempty" gorm:"column:disableocspendpointcheck" bson:"disableOCSPEndpointCheck,omitempty" dynamodbav:"disableOCSPEndpointCheck,omitempty" firestore:"disableOCSPEndpointCheck,omitempty"`
+	Direct                   *bool                 `mapstructure:"direct" json:"direct,omitempty" gorm:"column:direct" bson:"direct,omitempty" dynamodbav:"direct,omitempty" firestore:"direct,omitempty"`
+	ReadPreference           *ReadPreferenceConfig `mapstructure:"read_preference" json:"readPreference,omitempty" gorm:"column:readpreference" bson:"readPreference,omitempty" dynamodbav:"readPreference,omitempty" firestore:"readPreference,omitempty"`
+	ReadConcern              string                `mapstructure:"read_concern" json:"readConcern,omitempty" gorm:"column:readconcern" bson:"readConcern,omitempty" dynamodbav:"readConcern,omitempty" firestore:"readConcern,omitempty"`
+	WriteConcern             *WriteConcernConfig   `mapstructure:"write_concern" json:"writeConcern,omitempty" gorm:"column:writeconcern" bson:"writeConcern,omitempty" dynamodbav:"writeConcern,omitempty" firestore:"writeConcern,omitempty"`
+	TLS                      *TLSConfig            `mapstructure:"tls" json:"tls,omitempty" gorm:"column:tls" bson:"tls,omitempty" dynamodbav:"tls,omitempty" firestore:"tls,omitempty"`
+}
+
+// TLSConfig configures TLS. CertFile and KeyFile are the PEM files of the client certificate, for X.509 authentication; they can be the same file.
+// KeyPassword decrypts an encrypted key.
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file" json:"caFile,omitempty" gorm:"column:cafile" bson:"caFile,omitempty" dynamodbav:"caFile,omitempty" firestore:"caFile,omitempty"`
+	CertFile           string `mapstructure:"cert_file" json:"certFile,omitempty" gorm:"column:certfile" bson:"certFile,omitempty" dynamodbav:"certFile,omitempty" firestore:"certFile,omitempty"`
+	KeyFile            string `mapstructure:"key_file" json:"keyFile,omitempty" gorm:"column:keyfile" bson:"keyFile,omitempty" dynamodbav:"keyFile,omitempty" firestore:"keyFile,omitempty"`
+	KeyPassword        string `mapstructure:"key_password" json:"keyPassword,omitempty" gorm:"column:keypassword" bson:"keyPassword,omitempty" dynamodbav:"keyPassword,omitempty" firestore:"keyPassword,omitempty"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" json:"insecureSkipVerify,omitempty" gorm:"column:insecureskipverify" bson:"insecureSkipVerify,omitempty" dynamodbav:"insecureSkipVerify,omitempty" firestore:"insecureSkipVerify,omitempty"`
+}
+
+// ReadPreferenceConfig configures the read preference. Mode is primary, primaryPreferred, secondary, secondaryPreferred or nearest.
+// MaxStaleness is in seconds, and cannot be used with primary.
+type ReadPreferenceConfig struct {
+	Mode         string              `mapstructure:"mode" json:"mode,omitempty" gorm:"column:mode" bson:"mode,omitempty" dynamodbav:"mode,omitempty" firestore:"mode,omitempty"`
+	TagSets      []map[string]string `mapstructure:"tag_sets" json:"tagSets,omitempty" gorm:"column:tagsets" bson:"tagSets,omitempty" dynamodbav:"tagSets,omitempty" firestore:"tagSets,omitempty"`
+	MaxStaleness int64               `mapstructure:"max_staleness" json:"maxStaleness,omitempty" gorm:"column:maxstaleness" bson:"maxStaleness,omitempty" dynamodbav:"maxStaleness,omitempty" firestore:"maxStaleness,omitempty"`
+}
+
+// WriteConcernConfig configures the write concern. W is majority, a number of nodes or a tag set name. WTimeout is in milliseconds.
+type WriteConcernConfig struct {
+	W        string `mapstructure:"w" json:"w,omitempty" gorm:"column:w" bson:"w,omitempty" dynamodbav:"w,omitempty" firestore:"w,omitempty"`
+	J        *bool  `mapstructure:"j" json:"j,omitempty" gorm:"column:j" bson:"j,omitempty" dynamodbav:"j,omitempty" firestore:"j,omitempty"`
+	WTimeout int64  `mapstructure:"wtimeout" json:"wtimeout,omitempty" gorm:"column:wtimeout" bson:"wtimeout,omitempty" dynamodbav:"wtimeout,omitempty" firestore:"wtimeout,omitempty"`
+}
+
+// ConcernConfig overrides the concerns of the client for a component, such as a Loader, a Writer, a SearchBuilder or a batch writer.
+type ConcernConfig struct {
+	ReadPreference *ReadPreferenceConfig `mapstructure:"read_preference" json:"readPreference,omitempty" gorm:"column:readpreference" bson:"readPreference,omitempty" dynamodbav:"readPreference,omitempty" firestore:"readPreference,omitempty"`
+	ReadConcern    string                `mapstructure:"read_concern" json:"readConcern,omitempty" gorm:"column:readconcern" bson:"readConcern,omitempty" dynamodbav:"readConcern,omitempty" firestore:"readConcern,omitempty"`
+	WriteConcern   *WriteConcernConfig   `mapstructure:"write_concern" json:"writeConcern,omitempty" gorm:"column:writeconcern" bson:"writeConcern,omitempty" dynamodbav:"writeConcern,omitempty" firestore:"writeConcern,omitempty"`
 }
 
 type CredentialConfig struct {
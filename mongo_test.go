@@ -0,0 +1,63 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+)
+
+type versionedItem struct {
+	Id      string `bson:"_id"`
+	Name    string `bson:"name"`
+	Version int32  `bson:"version"`
+}
+
+func TestUpdateManyWithVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	mt.Run("conflict", func(mt *mtest.T) {
+		models := []versionedItem{{Id: "1", Version: 1}, {Id: "2", Version: 1}, {Id: "3", Version: 4}}
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "1"}, {Key: "version", Value: 2}},
+				bson.D{{Key: "_id", Value: "2"}, {Key: "version", Value: 7}},
+				bson.D{{Key: "_id", Value: "3"}, {Key: "version", Value: 5}}),
+		)
+		_, fails, err := UpdateManyWithVersion(context.Background(), mt.Coll, models, "Id", 2)
+		if !errors.Is(err, ErrVersionConflict) {
+			mt.Fatalf("error: %v, expected ErrVersionConflict", err)
+		}
+		if len(fails) != 1 || fails[0] != 1 {
+			mt.Fatalf("fails: %v, expected [1]", fails)
+		}
+		if models[0].Version != 2 || models[1].Version != 1 || models[2].Version != 5 {
+			mt.Fatalf("versions: %v", models)
+		}
+		update := mt.GetStartedEvent()
+		if update.CommandName != "update" {
+			mt.Fatalf("command: %s, expected one update", update.CommandName)
+		}
+		if updates, _ := update.Command.Lookup("updates").Array().Values(); len(updates) != 3 {
+			mt.Fatalf("updates: %d, expected 3", len(updates))
+		}
+		if find := mt.GetStartedEvent(); find == nil || find.CommandName != "find" {
+			mt.Fatal("the versions are not read in one find")
+		}
+	})
+	mt.Run("all updated", func(mt *mtest.T) {
+		models := []versionedItem{{Id: "1", Version: 1}, {Id: "2", Version: 1}}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+		_, fails, err := UpdateManyWithVersion(context.Background(), mt.Coll, models, "Id", 2)
+		if err != nil || len(fails) != 0 {
+			mt.Fatal(err, fails)
+		}
+		mt.GetStartedEvent()
+		if e := mt.GetStartedEvent(); e != nil {
+			mt.Fatalf("unexpected command %s", e.CommandName)
+		}
+	})
+}
@@ -10,6 +10,8 @@ type MongoWriter struct {
 	collection *mongo.Collection
 	IdName     string
 	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	Auditor    *Auditor
+	Retry      *RetryPolicy
 }
 
 func NewMongoWriterById(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options ...func(context.Context, interface{}) (interface{}, error)) *MongoWriter {
@@ -30,13 +32,20 @@ func NewMongoWriter(database *mongo.Database, collectionName string, modelType r
 }
 
 func (w *MongoWriter) Write(ctx context.Context, model interface{}) error {
+	return w.Retry.Do(ctx, func(ctx context.Context) error {
+		return w.write(ctx, model)
+	})
+}
+
+func (w *MongoWriter) write(ctx context.Context, model interface{}) error {
+	w.Auditor.Save(ctx, model)
 	if w.Map != nil {
 		m2, er0 := w.Map(ctx, model)
 		if er0 != nil {
 			return er0
 		}
-		return Upsert(ctx, w.collection, m2, w.IdName)
+		return Upsert(ctx, w.collection, m2, w.IdName, w.Auditor.CreatedFields(model)...)
 	}
-	err := Upsert(ctx, w.collection, model, w.IdName)
+	err := Upsert(ctx, w.collection, model, w.IdName, w.Auditor.CreatedFields(model)...)
 	return err
 }
@@ -0,0 +1,105 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClientOption customizes the client options built from MongoConfig, see BuildClientOptions.
+type ClientOption func(*options.ClientOptions)
+
+// WithCommandMonitor adds m to the command monitor of the client, keeping the monitor already set.
+func WithCommandMonitor(m *event.CommandMonitor) ClientOption {
+	return func(option *options.ClientOptions) {
+		option.SetMonitor(MergeCommandMonitors(option.Monitor, m))
+	}
+}
+
+// WithPoolMonitor adds m to the pool monitor of the client, keeping the monitor already set.
+func WithPoolMonitor(m *event.PoolMonitor) ClientOption {
+	return func(option *options.ClientOptions) {
+		option.SetPoolMonitor(MergePoolMonitors(option.PoolMonitor, m))
+	}
+}
+
+func MergeCommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	list := make([]*event.CommandMonitor, 0, len(monitors))
+	for _, m := range monitors {
+		if m != nil {
+			list = append(list, m)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range list {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range list {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range list {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+func MergePoolMonitors(monitors ...*event.PoolMonitor) *event.PoolMonitor {
+	list := make([]*event.PoolMonitor, 0, len(monitors))
+	for _, m := range monitors {
+		if m != nil && m.Event != nil {
+			list = append(list, m)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			for _, m := range list {
+				m.Event(e)
+			}
+		},
+	}
+}
+
+// commandCollection returns the collection of a command, which is the value of the first element, or "collection" for getMore.
+func commandCollection(command string, raw bson.Raw) string {
+	if command == "getMore" {
+		if v, err := raw.LookupErr("collection"); err == nil {
+			if s, ok := v.StringValueOK(); ok {
+				return s
+			}
+		}
+		return ""
+	}
+	elements, err := raw.Elements()
+	if err != nil || len(elements) == 0 {
+		return ""
+	}
+	if s, ok := elements[0].Value().StringValueOK(); ok {
+		return s
+	}
+	return ""
+}
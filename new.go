@@ -4,14 +4,41 @@ import (
 	"context"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
 	"time"
 )
 
-func NewClientOptions(c MongoConfig) *options.ClientOptions {
+// NewClientOptions builds the client options of c. If c is invalid, the error is logged and nil is returned instead of the options built so far,
+// which miss the invalid tls, credential or concerns; the caller must check it, because the driver connects to localhost with nil options.
+//
+// Deprecated: use BuildClientOptions, which returns the error.
+func NewClientOptions(c MongoConfig, opts ...ClientOption) *options.ClientOptions {
+	option, err := BuildClientOptions(c, opts...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil
+	}
+	return option
+}
+
+// BuildClientOptions builds the client options of c, and returns an error if the credential, read preference, read concern, write concern or tls is invalid.
+// The other settings of c are validated by LoadMongoConfig.
+// The opts are applied after the config.
+func BuildClientOptions(c MongoConfig, opts ...ClientOption) (*options.ClientOptions, error) {
 	option := options.Client().ApplyURI(c.Uri)
+	if err := ValidateCredential(c); err != nil {
+		return option, err
+	}
 	if len(c.ReplicaSet) > 0 {
 		option = option.SetReplicaSet(c.ReplicaSet)
 	}
+	if c.TLS != nil {
+		tlsConfig, err := BuildTLSConfig(*c.TLS)
+		if err != nil {
+			return option, err
+		}
+		option = option.SetTLSConfig(tlsConfig)
+	}
 	if c.Credential != nil {
 		cr := *c.Credential
 		cred := options.Credential {
@@ -80,21 +107,48 @@ func NewClientOptions(c MongoConfig) *options.ClientOptions {
 	if c.Direct != nil {
 		option = option.SetDirect(*c.Direct)
 	}
-	return option
+	if c.ReadPreference != nil {
+		rp, err := BuildReadPreference(*c.ReadPreference)
+		if err != nil {
+			return option, err
+		}
+		option = option.SetReadPreference(rp)
+	}
+	if len(c.ReadConcern) > 0 {
+		rc, err := BuildReadConcern(c.ReadConcern)
+		if err != nil {
+			return option, err
+		}
+		option = option.SetReadConcern(rc)
+	}
+	if c.WriteConcern != nil {
+		wc, err := BuildWriteConcern(*c.WriteConcern)
+		if err != nil {
+			return option, err
+		}
+		option = option.SetWriteConcern(wc)
+	}
+	for _, opt := range opts {
+		opt(option)
+	}
+	return option, nil
 }
-func ConnectToDatabase(ctx context.Context, conf MongoConfig) (*mongo.Database, error) {
-	return Setup(ctx, conf)
+func ConnectToDatabase(ctx context.Context, conf MongoConfig, opts ...ClientOption) (*mongo.Database, error) {
+	return Setup(ctx, conf, opts...)
 }
-func Setup(ctx context.Context, conf MongoConfig) (*mongo.Database, error) {
-	client, err := Connect(ctx, conf)
+func Setup(ctx context.Context, conf MongoConfig, opts ...ClientOption) (*mongo.Database, error) {
+	client, err := Connect(ctx, conf, opts...)
 	if err != nil {
 		return nil, err
 	}
 	db := client.Database(conf.Database)
 	return db, nil
 }
-func Connect(ctx context.Context, conf MongoConfig) (*mongo.Client, error) {
-	option := NewClientOptions(conf)
+func Connect(ctx context.Context, conf MongoConfig, opts ...ClientOption) (*mongo.Client, error) {
+	option, err := BuildClientOptions(conf, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return mongo.Connect(ctx, option)
 }
 func CreateConnection(ctx context.Context, uri string, database string) (*mongo.Database, error) {
@@ -9,25 +9,32 @@ import (
 	"strings"
 )
 
+type CountMode int
+
+const (
+	CountExact CountMode = iota
+	CountNone
+	// CountEstimated uses EstimatedDocumentCount when the query is empty, else counts exactly.
+	CountEstimated
+	// CountCapped counts up to a limit. A total of limit + 1 means "more than limit".
+	CountCapped
+)
+
 func BuildSearchResult(ctx context.Context, collection *mongo.Collection, results interface{}, query bson.M, fields bson.M, sort bson.M, pageIndex int64, pageSize int64, initPageSize int64, opts ...func(context.Context, interface{}) (interface{}, error)) (int64, error) {
+	return BuildSearchResultWithCount(ctx, collection, results, query, fields, sort, pageIndex, pageSize, initPageSize, CountExact, 0, opts...)
+}
+
+// BuildSearchResultWithCount is the same as BuildSearchResult, but counts the total by countMode. The total is -1 for CountNone.
+func BuildSearchResultWithCount(ctx context.Context, collection *mongo.Collection, results interface{}, query bson.M, fields bson.M, sort bson.M, pageIndex int64, pageSize int64, initPageSize int64, countMode CountMode, countLimit int64, opts ...func(context.Context, interface{}) (interface{}, error)) (int64, error) {
 	var mp func(context.Context, interface{}) (interface{}, error)
 	if len(opts) > 0 {
 		mp = opts[0]
 	}
 	optionsFind := options.Find()
 	optionsFind.Projection = fields
-	if initPageSize > 0 {
-		if pageIndex == 1 {
-			optionsFind.SetSkip(0)
-			optionsFind.SetLimit(initPageSize)
-		} else {
-			optionsFind.SetSkip(pageSize*(pageIndex-2) + initPageSize)
-			optionsFind.SetLimit(pageSize)
-		}
-	} else {
-		optionsFind.SetSkip(pageSize * (pageIndex - 1))
-		optionsFind.SetLimit(pageSize)
-	}
+	skip, limit := GetSkipAndLimit(pageIndex, pageSize, initPageSize)
+	optionsFind.SetSkip(skip)
+	optionsFind.SetLimit(limit)
 	if sort != nil {
 		optionsFind.SetSort(sort)
 	}
@@ -41,8 +48,7 @@ func BuildSearchResult(ctx context.Context, collection *mongo.Collection, result
 	if er1 != nil {
 		return 0, er1
 	}
-	options := options.Count()
-	count, er2 := collection.CountDocuments(ctx, query, options)
+	count, er2 := Count(ctx, collection, query, countMode, countLimit)
 	if er2 != nil {
 		return 0, er2
 	}
@@ -53,14 +59,52 @@ func BuildSearchResult(ctx context.Context, collection *mongo.Collection, result
 	return count, er3
 }
 
+func GetSkipAndLimit(pageIndex int64, pageSize int64, initPageSize int64) (int64, int64) {
+	if initPageSize > 0 {
+		if pageIndex == 1 {
+			return 0, initPageSize
+		}
+		return pageSize*(pageIndex-2) + initPageSize, pageSize
+	}
+	return pageSize * (pageIndex - 1), pageSize
+}
+
+func Count(ctx context.Context, collection *mongo.Collection, query bson.M, countMode CountMode, countLimit int64) (int64, error) {
+	switch countMode {
+	case CountNone:
+		return -1, nil
+	case CountEstimated:
+		if len(query) == 0 {
+			return collection.EstimatedDocumentCount(ctx)
+		}
+	case CountCapped:
+		if countLimit > 0 {
+			return collection.CountDocuments(ctx, query, options.Count().SetLimit(countLimit+1))
+		}
+	}
+	return collection.CountDocuments(ctx, query, options.Count())
+}
+
 func BuildSort(s string, modelType reflect.Type) bson.M {
 	var sort = bson.M{}
+	for _, e := range BuildSortFields(s, modelType) {
+		sort[e.Key] = e.Value
+	}
+	return sort
+}
+
+// BuildSortFields is the same as BuildSort, but keeps the order of the sort fields.
+func BuildSortFields(s string, modelType reflect.Type) bson.D {
+	var sort = bson.D{}
 	if len(s) == 0 {
 		return sort
 	}
 	sorts := strings.Split(s, ",")
 	for i := 0; i < len(sorts); i++ {
 		sortField := strings.TrimSpace(sorts[i])
+		if len(sortField) == 0 {
+			continue
+		}
 		fieldName := sortField
 		c := sortField[0:1]
 		if c == "-" || c == "+" {
@@ -69,7 +113,7 @@ func BuildSort(s string, modelType reflect.Type) bson.M {
 
 		columnName := GetBsonNameForSort(modelType, fieldName)
 		sortType := GetSortType(c)
-		sort[columnName] = sortType
+		sort = append(sort, bson.E{Key: columnName, Value: sortType})
 	}
 	return sort
 }
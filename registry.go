@@ -0,0 +1,129 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrRegistryClosed = errors.New("registry is closed")
+
+// Registry connects the databases of a map of MongoConfig, keyed by name, and shares one client for the configs with the same uri and options.
+type Registry struct {
+	mu        sync.RWMutex
+	clients   map[string]*mongo.Client
+	databases map[string]*mongo.Database
+	closed    bool
+}
+
+func NewRegistry(ctx context.Context, configs map[string]MongoConfig, opts ...ClientOption) (*Registry, error) {
+	r := &Registry{clients: make(map[string]*mongo.Client), databases: make(map[string]*mongo.Database)}
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := r.Add(ctx, name, configs[name], opts...); err != nil {
+			_ = r.Close(ctx)
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add connects the database of c as name, reusing the client of a config with the same uri and options.
+// The opts are only applied when a new client is connected.
+func (r *Registry) Add(ctx context.Context, name string, c MongoConfig, opts ...ClientOption) error {
+	key, err := clientKey(c)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRegistryClosed
+	}
+	if _, ok := r.databases[name]; ok {
+		return fmt.Errorf("database %s is already registered", name)
+	}
+	client, ok := r.clients[key]
+	if !ok {
+		client, err = Connect(ctx, c, opts...)
+		if err != nil {
+			return fmt.Errorf("cannot connect database %s: %w", name, err)
+		}
+		r.clients[key] = client
+	}
+	r.databases[name] = client.Database(c.Database)
+	return nil
+}
+
+// clientKey returns the config without the database, to share the clients.
+func clientKey(c MongoConfig) (string, error) {
+	type config MongoConfig
+	c.Database = ""
+	data, err := json.Marshal(config(c))
+	return string(data), err
+}
+
+func (r *Registry) Database(name string) (*mongo.Database, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return nil, ErrRegistryClosed
+	}
+	db, ok := r.databases[name]
+	if !ok {
+		return nil, fmt.Errorf("database %s is not registered", name)
+	}
+	return db, nil
+}
+
+func (r *Registry) Client(name string) (*mongo.Client, error) {
+	db, err := r.Database(name)
+	if err != nil {
+		return nil, err
+	}
+	return db.Client(), nil
+}
+
+// Close disconnects all clients. The in-flight operations are drained until ctx is done, then their connections are closed.
+// After Close, Database and Add return ErrRegistryClosed.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	clients := r.clients
+	r.clients = make(map[string]*mongo.Client)
+	r.databases = make(map[string]*mongo.Database)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	messages := make([]string, 0)
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *mongo.Client) {
+			defer wg.Done()
+			if err := client.Disconnect(ctx); err != nil {
+				mu.Lock()
+				messages = append(messages, err.Error())
+				mu.Unlock()
+			}
+		}(client)
+	}
+	wg.Wait()
+	if len(messages) > 0 {
+		return errors.New("cannot disconnect: " + strings.Join(messages, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+const (
+	RetryableWriteError = "RetryableWriteError"
+	NetworkError        = "NetworkError"
+)
+
+// RetryableCodes are the server error codes of the transient failures, such as a primary step-down or a shutdown.
+var RetryableCodes = []int{6, 7, 89, 91, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// RetryPolicy retries the writes, which fail by transient errors, with an exponential backoff and jitter.
+// A nil *RetryPolicy writes once, so WriteWithStatus can be used to get the status of each model without retry.
+// Inside a transaction, the writes are not retried, because the whole transaction is retried by WithTransaction.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts, including the first one, 3 by default.
+	MaxAttempts int `mapstructure:"max_attempts" json:"maxAttempts,omitempty" gorm:"column:maxattempts" bson:"maxAttempts,omitempty" dynamodbav:"maxAttempts,omitempty" firestore:"maxAttempts,omitempty"`
+	// InitialBackoff is the delay before the second attempt, 100ms by default.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" json:"initialBackoff,omitempty" gorm:"column:initialbackoff" bson:"initialBackoff,omitempty" dynamodbav:"initialBackoff,omitempty" firestore:"initialBackoff,omitempty"`
+	// MaxBackoff is the max delay between two attempts, 5s by default.
+	MaxBackoff time.Duration `mapstructure:"max_backoff" json:"maxBackoff,omitempty" gorm:"column:maxbackoff" bson:"maxBackoff,omitempty" dynamodbav:"maxBackoff,omitempty" firestore:"maxBackoff,omitempty"`
+	// Multiplier is the growth of the delay after each attempt, 2 by default.
+	Multiplier float64 `mapstructure:"multiplier" json:"multiplier,omitempty" gorm:"column:multiplier" bson:"multiplier,omitempty" dynamodbav:"multiplier,omitempty" firestore:"multiplier,omitempty"`
+	// Jitter is the fraction of the delay, which is randomized, from 0 to 1.
+	Jitter float64 `mapstructure:"jitter" json:"jitter,omitempty" gorm:"column:jitter" bson:"jitter,omitempty" dynamodbav:"jitter,omitempty" firestore:"jitter,omitempty"`
+	// Retryable classifies the errors, IsRetryableError by default.
+	Retryable func(err error) bool `mapstructure:"-" json:"-" gorm:"-" bson:"-" dynamodbav:"-" firestore:"-"`
+}
+
+// WriteStatus is the final status of a model of a batch write.
+type WriteStatus struct {
+	Attempts int
+	Err      error
+}
+
+// IsRetryableError returns true if err has the RetryableWriteError or NetworkError label, or one of RetryableCodes.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if HasErrorLabel(err, RetryableWriteError) || HasErrorLabel(err, NetworkError) {
+		return true
+	}
+	var writeError mongo.WriteError
+	if errors.As(err, &writeError) {
+		return isRetryableCode(writeError.Code)
+	}
+	var serverError mongo.ServerError
+	if errors.As(err, &serverError) {
+		for _, code := range RetryableCodes {
+			if serverError.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isRetryableCode(code int) bool {
+	for _, c := range RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) maxAttempts(ctx context.Context) int {
+	if p == nil || InTransaction(ctx) {
+		return 1
+	}
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// Backoff returns the delay before the next attempt, after the given number of attempts.
+func (p *RetryPolicy) Backoff(attempts int) time.Duration {
+	initial, max, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(initial) * math.Pow(multiplier, float64(attempts-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d = d * (1 - jitter*rand.Float64())
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) wait(ctx context.Context, attempts int) error {
+	timer := time.NewTimer(p.Backoff(attempts))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Do calls fn until it succeeds, it returns an error which is not retryable, or the attempts are exhausted.
+func (p *RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	maxAttempts := p.maxAttempts(ctx)
+	for attempts := 1; ; attempts++ {
+		err := fn(ctx)
+		if err == nil || attempts >= maxAttempts || !p.retryable(err) {
+			return err
+		}
+		if er1 := p.wait(ctx, attempts); er1 != nil {
+			return err
+		}
+	}
+}
+
+// WriteWithStatus writes models by write, then retries only the models which fail by retryable errors, and returns the final status of each model.
+// The returned error is a *DuplicateKeyErrors if some models are duplicated, else the first error of the models.
+func (p *RetryPolicy) WriteWithStatus(ctx context.Context, models interface{}, write func(context.Context, interface{}) ([]int, []int, error)) ([]WriteStatus, error) {
+	values := reflect.Indirect(reflect.ValueOf(models))
+	length := values.Len()
+	statuses := make([]WriteStatus, length)
+	pending := make([]int, length)
+	for i := range pending {
+		pending[i] = i
+	}
+	maxAttempts := p.maxAttempts(ctx)
+	for attempts := 1; len(pending) > 0; attempts++ {
+		batch := models
+		if len(pending) < length {
+			subset := reflect.MakeSlice(values.Type(), 0, len(pending))
+			for _, i := range pending {
+				subset = reflect.Append(subset, values.Index(i))
+			}
+			batch = subset.Interface()
+		}
+		successIndices, _, err := write(ctx, batch)
+		errs := writeErrorsByIndex(err)
+		next := make([]int, 0)
+		for k, i := range pending {
+			statuses[i].Attempts = attempts
+			if err == nil || InArray(k, successIndices) {
+				statuses[i].Err = nil
+				continue
+			}
+			e, ok := errs[k]
+			// an ordered bulk write stops at its first write error, so the next models are not written, and are written again
+			stopped := !ok && len(errs) > 0
+			if !ok {
+				e = err
+			}
+			statuses[i].Err = e
+			if attempts < maxAttempts && (stopped || p.retryable(e)) {
+				next = append(next, i)
+			}
+		}
+		pending = next
+		if len(pending) > 0 {
+			if er1 := p.wait(ctx, attempts); er1 != nil {
+				break
+			}
+		}
+	}
+	return statuses, statusError(statuses)
+}
+
+// writeErrorsByIndex returns the write errors of a bulk write, by the positions in the batch.
+func writeErrorsByIndex(err error) map[int]error {
+	errs := make(map[int]error)
+	var bulkWriteException mongo.BulkWriteException
+	if err == nil || !errors.As(err, &bulkWriteException) {
+		return errs
+	}
+	for _, e := range bulkWriteException.WriteErrors {
+		if isDuplicateKeyCode(e.Code) {
+			errs[e.Index] = newWriteDuplicateKeyError(e.WriteError)
+		} else {
+			errs[e.Index] = e.WriteError
+		}
+	}
+	return errs
+}
+
+func statusError(statuses []WriteStatus) error {
+	var firstErr, otherErr error
+	var duplicates *DuplicateKeyErrors
+	for i, status := range statuses {
+		if status.Err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = status.Err
+		}
+		var d *DuplicateKeyError
+		if !errors.As(status.Err, &d) {
+			if otherErr == nil {
+				otherErr = status.Err
+			}
+		} else {
+			if duplicates == nil {
+				duplicates = &DuplicateKeyErrors{}
+			}
+			shifted := *d
+			shifted.Index = i
+			duplicates.Errors = append(duplicates.Errors, &shifted)
+		}
+	}
+	if duplicates != nil {
+		// the duplicate key errors of the statuses have the positions of the attempts, so only another error is wrapped
+		duplicates.err = otherErr
+		return duplicates
+	}
+	return firstErr
+}
+
+// WriteWithRetry writes models by write with the retry policy, and returns the success and fail indices.
+func WriteWithRetry(ctx context.Context, models interface{}, p *RetryPolicy, write func(context.Context, interface{}) ([]int, []int, error)) ([]int, []int, error) {
+	if p == nil {
+		return write(ctx, models)
+	}
+	statuses, err := p.WriteWithStatus(ctx, models, write)
+	successIndices, failIndices := SplitStatuses(statuses)
+	return successIndices, failIndices, err
+}
+
+// SplitStatuses returns the success and fail indices of the statuses.
+func SplitStatuses(statuses []WriteStatus) ([]int, []int) {
+	successIndices := make([]int, 0)
+	failIndices := make([]int, 0)
+	for i, status := range statuses {
+		if status.Err == nil {
+			successIndices = append(successIndices, i)
+		} else {
+			failIndices = append(failIndices, i)
+		}
+	}
+	return successIndices, failIndices
+}
@@ -10,9 +10,16 @@ import (
 type SearchBuilder struct {
 	Collection *mongo.Collection
 	BuildQuery func(m interface{}) (bson.M, bson.M)
-	GetSort    func(m interface{}) string
-	BuildSort  func(s string, modelType reflect.Type) bson.M
-	Map        func(ctx context.Context, model interface{}) (interface{}, error)
+	// BuildFilter, if set, is used instead of BuildQuery, to return the errors of the query, such as EncryptionMapper.BuildQuery.
+	BuildFilter func(ctx context.Context, m interface{}) (bson.M, bson.M, error)
+	GetSort     func(m interface{}) string
+	BuildSort   func(s string, modelType reflect.Type) bson.M
+	// BuildSortFields builds the ordered sort of SearchByToken. It is set by the constructor only if BuildSort is the default one.
+	BuildSortFields func(s string, modelType reflect.Type) bson.D
+	Map             func(ctx context.Context, model interface{}) (interface{}, error)
+	SoftDelete      *SoftDeleteConfig
+	CountMode       CountMode
+	CountLimit      int64
 }
 
 func NewSearchBuilderWithSort(db *mongo.Database, collectionName string, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...func(context.Context, interface{}) (interface{}, error)) *SearchBuilder {
@@ -22,13 +29,20 @@ func NewSearchBuilderWithSort(db *mongo.Database, collectionName string, buildQu
 	}
 	collection := db.Collection(collectionName)
 	builder := &SearchBuilder{Collection: collection, BuildQuery: buildQuery, GetSort: getSort, BuildSort: buildSort, Map: mp}
+	if buildSort == nil || reflect.ValueOf(buildSort).Pointer() == reflect.ValueOf(BuildSort).Pointer() {
+		builder.BuildSortFields = BuildSortFields
+	}
 	return builder
 }
 func NewSearchBuilder(db *mongo.Database, collectionName string, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) *SearchBuilder {
 	return NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, BuildSort, options...)
 }
 func (b *SearchBuilder) Search(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options ...int64) (int64, error) {
-	query, fields := b.BuildQuery(m)
+	query, fields, err := b.buildQuery(ctx, m)
+	if err != nil {
+		return 0, err
+	}
+	query = ExcludeDeleted(query, b.SoftDelete)
 
 	var sort = bson.M{}
 	s := b.GetSort(m)
@@ -40,5 +54,55 @@ func (b *SearchBuilder) Search(ctx context.Context, m interface{}, results inter
 	} else {
 		firstPageSize = 0
 	}
-	return BuildSearchResult(ctx, b.Collection, results, query, fields, sort, pageIndex, pageSize, firstPageSize, b.Map)
+	return BuildSearchResultWithCount(ctx, b.Collection, results, query, fields, sort, pageIndex, pageSize, firstPageSize, b.CountMode, b.CountLimit, b.Map)
+}
+
+// SearchWithFacets is the same as Search, and also returns the bucket counts of the facets declared in the search model (see GetFacetFields),
+// in one $facet aggregation.
+func (b *SearchBuilder) SearchWithFacets(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options ...int64) (int64, map[string][]FacetBucket, error) {
+	query, fields, err := b.buildQuery(ctx, m)
+	if err != nil {
+		return 0, nil, err
+	}
+	query = ExcludeDeleted(query, b.SoftDelete)
+
+	modelType := reflect.TypeOf(results).Elem().Elem()
+	sort := b.BuildSort(b.GetSort(m), modelType)
+	var firstPageSize int64
+	if len(options) > 0 && options[0] > 0 {
+		firstPageSize = options[0]
+	}
+	facets := GetFacetFields(m, modelType)
+	return BuildFacetSearchResult(ctx, b.Collection, results, query, fields, sort, pageIndex, pageSize, firstPageSize, facets, b.CountMode, b.Map)
+}
+
+// SearchByToken paginates by keyset instead of skip: it returns the page after nextPageToken and the token of the next page.
+// The order is built by BuildSortFields, then _id; ErrSortFieldsRequired is returned if it is not set, because BuildSort does not keep the order of the fields.
+// If count is false, the total is not counted and -1 is returned, else it is counted by CountMode.
+func (b *SearchBuilder) SearchByToken(ctx context.Context, m interface{}, results interface{}, limit int64, nextPageToken string, count bool) (string, int64, error) {
+	if b.BuildSortFields == nil {
+		return "", -1, ErrSortFieldsRequired
+	}
+	query, fields, err := b.buildQuery(ctx, m)
+	if err != nil {
+		return "", -1, err
+	}
+	query = ExcludeDeleted(query, b.SoftDelete)
+
+	modelType := reflect.TypeOf(results).Elem().Elem()
+	sort := b.BuildSortFields(b.GetSort(m), modelType)
+	next, err := BuildKeysetSearchResult(ctx, b.Collection, results, query, fields, sort, limit, nextPageToken, b.Map)
+	if err != nil || !count {
+		return next, -1, err
+	}
+	total, err := Count(ctx, b.Collection, query, b.CountMode, b.CountLimit)
+	return next, total, err
+}
+
+func (b *SearchBuilder) buildQuery(ctx context.Context, m interface{}) (bson.M, bson.M, error) {
+	if b.BuildFilter != nil {
+		return b.BuildFilter(ctx, m)
+	}
+	query, fields := b.BuildQuery(m)
+	return query, fields, nil
 }
@@ -23,7 +23,7 @@ func NewMongoSearchLoaderWithQueryAndSort(db *mongo.Database, collection string,
 	}
 	loader := NewMongoLoader(db, collection, modelType, idObjectId, mp)
 	builder := NewSearchBuilderWithSort(db, collection, buildQuery, getSort, buildSort, mp)
-	searcher := NewSearcher(builder.Search)
+	searcher := NewSearcherWithToken(builder.Search, builder.SearchByToken)
 	return searcher, loader
 }
 func NewMongoSearchLoader(db *mongo.Database, collection string, modelType reflect.Type, idObjectId bool, search func(context.Context, interface{}, interface{}, int64, int64, ...int64) (int64, error), options ...func(context.Context, interface{}) (interface{}, error)) (*Searcher, *Loader) {
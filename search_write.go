@@ -7,19 +7,24 @@ import (
 )
 
 func NewMongoSearchWriterWithVersionAndSort(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, version string, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...Mapper) (*Searcher, *Writer) {
+	return NewMongoSearchWriterWithSoftDelete(db, collectionName, modelType, idObjectId, version, nil, buildQuery, getSort, buildSort, options...)
+}
+func NewMongoSearchWriterWithSoftDelete(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, version string, softDelete *SoftDeleteConfig, buildQuery func(sm interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...Mapper) (*Searcher, *Writer) {
 	var mapper Mapper
 	if len(options) > 0 && options[0] != nil {
 		mapper = options[0]
 	}
 	if mapper != nil {
-		writer := NewWriterWithVersion(db, collectionName, modelType, idObjectId, version, mapper)
+		writer := NewWriterWithSoftDelete(db, collectionName, modelType, idObjectId, version, softDelete, mapper)
 		builder := NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort, mapper.DbToModel)
-		searcher := NewSearcher(builder.Search)
+		builder.SoftDelete = softDelete
+		searcher := NewSearcherWithToken(builder.Search, builder.SearchByToken)
 		return searcher, writer
 	} else {
-		writer := NewWriterWithVersion(db, collectionName, modelType, idObjectId, version)
+		writer := NewWriterWithSoftDelete(db, collectionName, modelType, idObjectId, version, softDelete)
 		builder := NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort)
-		searcher := NewSearcher(builder.Search)
+		builder.SoftDelete = softDelete
+		searcher := NewSearcherWithToken(builder.Search, builder.SearchByToken)
 		return searcher, writer
 	}
 }
@@ -2,27 +2,39 @@ package mongo
 
 import (
 	"context"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"reflect"
 )
 
 type Searcher struct {
-	search func(ctx context.Context, searchModel interface{}, results interface{}, pageIndex int64, pageSize int64, options...int64) (int64, error)
+	search        func(ctx context.Context, searchModel interface{}, results interface{}, pageIndex int64, pageSize int64, options...int64) (int64, error)
+	searchByToken func(ctx context.Context, searchModel interface{}, results interface{}, limit int64, nextPageToken string, count bool) (string, int64, error)
 }
 
 func NewSearcher(search func(context.Context, interface{}, interface{}, int64, int64, ...int64) (int64, error)) *Searcher {
 	return &Searcher{search: search}
 }
+func NewSearcherWithToken(search func(context.Context, interface{}, interface{}, int64, int64, ...int64) (int64, error), searchByToken func(context.Context, interface{}, interface{}, int64, string, bool) (string, int64, error)) *Searcher {
+	return &Searcher{search: search, searchByToken: searchByToken}
+}
 
 func (s *Searcher) Search(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options...int64) (int64, error) {
 	return s.search(ctx, m, results, pageIndex, pageSize, options...)
 }
 
+func (s *Searcher) SearchByToken(ctx context.Context, m interface{}, results interface{}, limit int64, nextPageToken string, count bool) (string, int64, error) {
+	if s.searchByToken == nil {
+		return "", 0, fmt.Errorf("search by next page token is not supported by this searcher")
+	}
+	return s.searchByToken(ctx, m, results, limit, nextPageToken, count)
+}
+
 func NewSearcherWithQuery(db *mongo.Database, collectionName string, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, options ...func(context.Context, interface{}) (interface{}, error)) *Searcher {
 	return NewSearcherWithQueryAndSort(db, collectionName, buildQuery, getSort, BuildSort, options...)
 }
 func NewSearcherWithQueryAndSort(db *mongo.Database, collectionName string, buildQuery func(interface{}) (bson.M, bson.M), getSort func(interface{}) string, buildSort func(string, reflect.Type) bson.M, options ...func(context.Context, interface{}) (interface{}, error)) *Searcher {
 	builder := NewSearchBuilderWithSort(db, collectionName, buildQuery, getSort, buildSort, options...)
-	return NewSearcher(builder.Search)
+	return NewSearcherWithToken(builder.Search, builder.SearchByToken)
 }
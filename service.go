@@ -0,0 +1,44 @@
+package mongo
+
+import (
+	"context"
+	"time"
+)
+
+type ModelLoader interface {
+	Id() string
+	All(ctx context.Context) (interface{}, error)
+	Load(ctx context.Context, id interface{}) (interface{}, error)
+	LoadAndDecode(ctx context.Context, id interface{}, result interface{}) (bool, error)
+	Exist(ctx context.Context, id interface{}) (bool, error)
+}
+
+type ModelWriter interface {
+	ModelLoader
+	Insert(ctx context.Context, model interface{}) (int64, error)
+	Update(ctx context.Context, model interface{}) (int64, error)
+	Patch(ctx context.Context, model map[string]interface{}) (int64, error)
+	Save(ctx context.Context, model interface{}) (int64, error)
+	Delete(ctx context.Context, id interface{}) (int64, error)
+}
+
+type ModelSearcher interface {
+	Search(ctx context.Context, m interface{}, results interface{}, pageIndex int64, pageSize int64, options ...int64) (int64, error)
+}
+
+type PasscodeStore interface {
+	Save(ctx context.Context, id string, passcode string, expiredAt time.Time) (int64, error)
+	Load(ctx context.Context, id string) (string, time.Time, error)
+	Delete(ctx context.Context, id string) (int64, error)
+}
+
+var (
+	_ ModelLoader   = (*Loader)(nil)
+	_ ModelWriter   = (*Writer)(nil)
+	_ ModelSearcher = (*Searcher)(nil)
+	_ ModelSearcher = (*SearchBuilder)(nil)
+	_ PasscodeStore = (*PasscodeRepository)(nil)
+	_ ModelWriter   = (*MemoryWriter)(nil)
+	_ ModelSearcher = (*MemorySearcher)(nil)
+	_ PasscodeStore = (*MemoryPasscodeRepository)(nil)
+)
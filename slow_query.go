@@ -0,0 +1,379 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SlowQuery struct {
+	Database   string        `json:"database,omitempty"`
+	Collection string        `json:"collection,omitempty"`
+	Command    string        `json:"command,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Filter     string        `json:"filter,omitempty"`
+	// DocsExamined is the totalDocsExamined of the explain, or -1 if the command is not explained.
+	DocsExamined int64 `json:"docsExamined"`
+	// Error is the code name of the failure, such as DuplicateKey, without the message, which can contain the values of the documents.
+	Error string `json:"error,omitempty"`
+}
+
+func (q SlowQuery) String() string {
+	s := fmt.Sprintf("slow query: %s %s.%s took %s filter %s", q.Command, q.Database, q.Collection, q.Duration, q.Filter)
+	if q.DocsExamined >= 0 {
+		s = s + fmt.Sprintf(" docs examined %d", q.DocsExamined)
+	}
+	if len(q.Error) > 0 {
+		s = s + " error: " + q.Error
+	}
+	return s
+}
+
+// SlowQueryLogger is a command monitor, which logs the commands exceeding Threshold, with the filter shape, where the literal values are redacted.
+// If Client is set and ExplainRate > 0, a sample of the commands is explained in the background, if they are slow, to get the docs examined,
+// and these commands are logged after the explain. At most MaxExplains explains run at the same time, the other slow commands are logged without explain.
+type SlowQueryLogger struct {
+	Threshold      time.Duration
+	Log            func(ctx context.Context, q SlowQuery)
+	Client         *mongo.Client
+	ExplainRate    float64
+	ExplainTimeout time.Duration
+	MaxExplains    int
+	pending        sync.Map
+	once           sync.Once
+	explains       chan struct{}
+}
+
+// startedCommand keeps the data of a started command to log it: the raw command is kept only if it is sampled to be explained.
+type startedCommand struct {
+	database   string
+	collection string
+	filter     string
+	command    bson.Raw
+}
+
+func NewSlowQueryLogger(threshold time.Duration, options ...func(ctx context.Context, q SlowQuery)) *SlowQueryLogger {
+	l := &SlowQueryLogger{Threshold: threshold, ExplainTimeout: 10 * time.Second, MaxExplains: 2}
+	if len(options) > 0 && options[0] != nil {
+		l.Log = options[0]
+	} else {
+		l.Log = LogSlowQuery
+	}
+	return l
+}
+
+func LogSlowQuery(ctx context.Context, q SlowQuery) {
+	log.Println(q.String())
+}
+
+// WithSlowQueryLogger adds the command monitor of l to the client, keeping the monitor already set.
+func WithSlowQueryLogger(l *SlowQueryLogger) ClientOption {
+	return WithCommandMonitor(l.CommandMonitor())
+}
+
+func (l *SlowQueryLogger) CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if e.CommandName == "explain" {
+				return
+			}
+			started := startedCommand{database: e.DatabaseName, collection: commandCollection(e.CommandName, e.Command)}
+			if explainable(e.CommandName) {
+				started.filter = FilterShape(commandFilter(e.CommandName, e.Command))
+				if l.Client != nil && l.ExplainRate > 0 && rand.Float64() < l.ExplainRate {
+					started.command = make(bson.Raw, len(e.Command))
+					copy(started.command, e.Command)
+				}
+			}
+			l.pending.Store(requestKey(e.ConnectionID, e.RequestID), started)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			l.finish(ctx, e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			l.finish(ctx, e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// failureName returns the code name of a failure formatted as "(Name) message" by the driver, or "failed" if it has no code name.
+func failureName(failure string) string {
+	if len(failure) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(failure, "(") {
+		if i := strings.IndexByte(failure, ')'); i > 1 {
+			return failure[1:i]
+		}
+	}
+	return "failed"
+}
+
+func (l *SlowQueryLogger) finish(ctx context.Context, e event.CommandFinishedEvent, failure string) {
+	v, ok := l.pending.LoadAndDelete(requestKey(e.ConnectionID, e.RequestID))
+	if !ok {
+		return
+	}
+	duration := time.Duration(e.DurationNanos)
+	if duration < l.Threshold {
+		return
+	}
+	started := v.(startedCommand)
+	q := SlowQuery{
+		Database:     started.database,
+		Collection:   started.collection,
+		Command:      e.CommandName,
+		Duration:     duration,
+		Filter:       started.filter,
+		DocsExamined: -1,
+		Error:        failureName(failure),
+	}
+	if started.command != nil && l.acquireExplain() {
+		// the operation is finished, so the log uses the values of its context, without its cancellation
+		logCtx := detachedContext{ctx}
+		go func() {
+			defer l.releaseExplain()
+			ctx2 := context.Background()
+			cancel := func() {}
+			if l.ExplainTimeout > 0 {
+				ctx2, cancel = context.WithTimeout(ctx2, l.ExplainTimeout)
+			}
+			defer cancel()
+			n, err := Explain(ctx2, l.Client.Database(started.database), started.command)
+			if err == nil {
+				q.DocsExamined = n
+			}
+			l.Log(logCtx, q)
+		}()
+		return
+	}
+	l.Log(ctx, q)
+}
+
+// acquireExplain returns false if MaxExplains explains are running, so the explains do not pile up on a slow cluster.
+func (l *SlowQueryLogger) acquireExplain() bool {
+	l.once.Do(func() {
+		n := l.MaxExplains
+		if n <= 0 {
+			n = 1
+		}
+		l.explains = make(chan struct{}, n)
+	})
+	select {
+	case l.explains <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *SlowQueryLogger) releaseExplain() {
+	<-l.explains
+}
+
+// detachedContext has the values of its parent, but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+func explainable(command string) bool {
+	switch command {
+	case "find", "aggregate", "count", "distinct", "delete", "update", "findAndModify":
+		return true
+	default:
+		return false
+	}
+}
+
+// Explain runs the explain of command with executionStats verbosity, and returns the totalDocsExamined.
+func Explain(ctx context.Context, db *mongo.Database, command bson.Raw) (int64, error) {
+	elements, err := command.Elements()
+	if err != nil {
+		return -1, err
+	}
+	cmd := make(bson.D, 0, len(elements))
+	for _, e := range elements {
+		key := e.Key()
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		switch key {
+		case "lsid", "txnNumber", "autocommit", "startTransaction", "readConcern", "writeConcern":
+			continue
+		}
+		cmd = append(cmd, bson.E{Key: key, Value: e.Value()})
+	}
+	var res bson.Raw
+	err = db.RunCommand(ctx, bson.D{{Key: "explain", Value: cmd}, {Key: "verbosity", Value: "executionStats"}}).Decode(&res)
+	if err != nil {
+		return -1, err
+	}
+	if n, ok := findDocsExamined(res); ok {
+		return n, nil
+	}
+	return -1, fmt.Errorf("totalDocsExamined is not found in explain of %s", cmd[0].Key)
+}
+
+func findDocsExamined(doc bson.Raw) (int64, bool) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return 0, false
+	}
+	for _, e := range elements {
+		v := e.Value()
+		if e.Key() == "totalDocsExamined" {
+			if n, ok := v.AsInt64OK(); ok {
+				return n, true
+			}
+		}
+		var sub bson.Raw
+		switch v.Type {
+		case bsontype.EmbeddedDocument:
+			sub = v.Document()
+		case bsontype.Array:
+			sub = bson.Raw(v.Array())
+		default:
+			continue
+		}
+		if n, ok := findDocsExamined(sub); ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// commandFilter returns the filter of command: the filter or query, the q of the first delete or update, or the $match stages of aggregate.
+func commandFilter(command string, raw bson.Raw) bson.RawValue {
+	switch command {
+	case "find":
+		return lookupRaw(raw, "filter")
+	case "count", "distinct", "findAndModify":
+		return lookupRaw(raw, "query")
+	case "delete":
+		return lookupRaw(raw, "deletes", "0", "q")
+	case "update":
+		return lookupRaw(raw, "updates", "0", "q")
+	case "aggregate":
+		pipeline := lookupRaw(raw, "pipeline")
+		arr, ok := pipeline.ArrayOK()
+		if !ok {
+			return bson.RawValue{}
+		}
+		values, err := arr.Values()
+		if err != nil {
+			return bson.RawValue{}
+		}
+		matches := make(bson.A, 0)
+		for _, stage := range values {
+			if doc, ok := stage.DocumentOK(); ok {
+				if m, err := doc.LookupErr("$match"); err == nil {
+					matches = append(matches, bson.D{{Key: "$match", Value: m}})
+				}
+			}
+		}
+		if len(matches) == 0 {
+			return bson.RawValue{}
+		}
+		t, data, err := bson.MarshalValue(matches)
+		if err != nil {
+			return bson.RawValue{}
+		}
+		return bson.RawValue{Type: t, Value: data}
+	default:
+		return bson.RawValue{}
+	}
+}
+
+func lookupRaw(raw bson.Raw, keys ...string) bson.RawValue {
+	v, err := raw.LookupErr(keys...)
+	if err != nil {
+		return bson.RawValue{}
+	}
+	return v
+}
+
+// FilterShape renders the filter with the keys and operators, and replaces the literal values by ?, so that it can be logged without the data.
+// An array of literal values is rendered as [?], and a regular expression as /?/ with its options.
+func FilterShape(v bson.RawValue) string {
+	if len(v.Value) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	writeShape(&b, v)
+	return b.String()
+}
+
+func writeShape(b *strings.Builder, v bson.RawValue) {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		elements, err := v.Document().Elements()
+		if err != nil {
+			b.WriteString("?")
+			return
+		}
+		b.WriteString("{")
+		for i, e := range elements {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(`"` + e.Key() + `": `)
+			writeShape(b, e.Value())
+		}
+		b.WriteString("}")
+	case bsontype.Array:
+		values, err := v.Array().Values()
+		if err != nil {
+			b.WriteString("?")
+			return
+		}
+		literal := true
+		for _, e := range values {
+			if e.Type == bsontype.EmbeddedDocument || e.Type == bsontype.Array {
+				literal = false
+				break
+			}
+		}
+		if literal {
+			b.WriteString("[?]")
+			return
+		}
+		b.WriteString("[")
+		for i, e := range values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeShape(b, e)
+		}
+		b.WriteString("]")
+	case bsontype.Regex:
+		// the regular expressions are rendered as regular expressions, so that the scans by query.Build can be found
+		_, options := v.Regex()
+		b.WriteString("/?/" + options)
+	default:
+		b.WriteString("?")
+	}
+}
@@ -0,0 +1,57 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type SoftDeleteConfig struct {
+	DeletedAt string `mapstructure:"deleted_at" json:"deletedAt,omitempty" gorm:"column:deletedat" bson:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty" firestore:"deletedAt,omitempty"`
+	DeletedBy string `mapstructure:"deleted_by" json:"deletedBy,omitempty" gorm:"column:deletedby" bson:"deletedBy,omitempty" dynamodbav:"deletedBy,omitempty" firestore:"deletedBy,omitempty"`
+	User      string `mapstructure:"user" json:"user,omitempty" gorm:"column:user" bson:"user,omitempty" dynamodbav:"user,omitempty" firestore:"user,omitempty"`
+}
+
+// ExcludeDeleted adds a condition to query, to skip the documents flagged by SoftDeleteOne.
+// If query already has a condition on the DeletedAt field, query is not changed.
+func ExcludeDeleted(query bson.M, c *SoftDeleteConfig) bson.M {
+	if c == nil || len(c.DeletedAt) == 0 {
+		return query
+	}
+	q := bson.M{}
+	for k, v := range query {
+		q[k] = v
+	}
+	if _, ok := q[c.DeletedAt]; !ok {
+		q[c.DeletedAt] = nil
+	}
+	return q
+}
+
+func SoftDeleteOne(ctx context.Context, collection *mongo.Collection, query bson.M, c SoftDeleteConfig) (int64, error) {
+	set := bson.M{c.DeletedAt: time.Now()}
+	if len(c.DeletedBy) > 0 {
+		set[c.DeletedBy] = GetString(ctx, c.User)
+	}
+	filter := ExcludeDeleted(query, &c)
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, err
+}
+
+func RestoreOne(ctx context.Context, collection *mongo.Collection, query bson.M, c SoftDeleteConfig) (int64, error) {
+	unset := bson.M{c.DeletedAt: ""}
+	if len(c.DeletedBy) > 0 {
+		unset[c.DeletedBy] = ""
+	}
+	filter := copyMap(query)
+	filter[c.DeletedAt] = bson.M{"$ne": nil}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$unset": unset})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, err
+}
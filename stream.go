@@ -0,0 +1,76 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+)
+
+type StreamOptions struct {
+	// BatchSize is the number of documents of each batch returned by the server, the server default if 0.
+	BatchSize int32
+	// NoCursorTimeout prevents the server from closing an idle cursor after 10 minutes, for slow handlers.
+	NoCursorTimeout bool
+	// After is the last seen _id, to resume an interrupted stream.
+	After interface{}
+}
+
+// FindAndStream decodes the documents of query one at a time, sorted by _id, and calls handle with a pointer to each model.
+// It returns the _id of the last handled document, so that the stream can be resumed with StreamOptions.After if it is interrupted.
+// The stream stops at the first error of handle.
+func FindAndStream(ctx context.Context, collection *mongo.Collection, query bson.M, modelType reflect.Type, handle func(ctx context.Context, model interface{}) error, opts ...StreamOptions) (interface{}, error) {
+	var o StreamOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	q := query
+	if o.After != nil {
+		q = bson.M{"$and": bson.A{query, bson.M{"_id": bson.M{"$gt": o.After}}}}
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if o.BatchSize > 0 {
+		findOptions.SetBatchSize(o.BatchSize)
+	}
+	if o.NoCursorTimeout {
+		findOptions.SetNoCursorTimeout(true)
+	}
+	cursor, err := collection.Find(ctx, q, findOptions)
+	if err != nil {
+		return o.After, err
+	}
+	defer cursor.Close(ctx)
+	lastId := o.After
+	for cursor.Next(ctx) {
+		model := reflect.New(modelType).Interface()
+		if er1 := cursor.Decode(model); er1 != nil {
+			return lastId, er1
+		}
+		if er2 := handle(ctx, model); er2 != nil {
+			return lastId, er2
+		}
+		var id interface{}
+		if er3 := cursor.Current.Lookup("_id").Unmarshal(&id); er3 != nil {
+			return lastId, er3
+		}
+		lastId = id
+	}
+	return lastId, cursor.Err()
+}
+
+// Stream iterates all models like All, but decodes them one at a time and applies Map before calling handle.
+func (m *Loader) Stream(ctx context.Context, handle func(ctx context.Context, model interface{}) error, opts ...StreamOptions) (interface{}, error) {
+	return m.StreamByQuery(ctx, bson.M{}, handle, opts...)
+}
+
+func (m *Loader) StreamByQuery(ctx context.Context, query bson.M, handle func(ctx context.Context, model interface{}) error, opts ...StreamOptions) (interface{}, error) {
+	return FindAndStream(ctx, m.Collection, ExcludeDeleted(query, m.SoftDelete), m.modelType, func(ctx context.Context, model interface{}) error {
+		if m.Map != nil {
+			if _, err := m.Map(ctx, model); err != nil {
+				return err
+			}
+		}
+		return handle(ctx, model)
+	}, opts...)
+}
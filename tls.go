@@ -0,0 +1,122 @@
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/youmark/pkcs8"
+	"io/ioutil"
+	"strings"
+)
+
+const MechanismX509 = "MONGODB-X509"
+
+// BuildTLSConfig loads the CA file and the client certificate of c.
+func BuildTLSConfig(c TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if len(c.CAFile) > 0 {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read tls ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("tls ca_file %s does not contain any PEM certificate", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(c.CertFile) == 0 && len(c.KeyFile) == 0 {
+		if len(c.KeyPassword) > 0 {
+			return nil, errors.New("tls key_password is set, but key_file is not")
+		}
+		return tlsConfig, nil
+	}
+	if len(c.CertFile) == 0 || len(c.KeyFile) == 0 {
+		return nil, errors.New("tls cert_file and key_file must be set together")
+	}
+	certPEM, err := ioutil.ReadFile(c.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls cert_file: %w", err)
+	}
+	keyFile, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls key_file: %w", err)
+	}
+	keyPEM, err := decodeKeyPEM(keyFile, c.KeyFile, c.KeyPassword)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("tls cert_file %s and key_file %s are not a valid key pair: %w", c.CertFile, c.KeyFile, err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
+
+// decodeKeyPEM returns the PEM of the private key of data, which can also contain certificates. An encrypted key, PKCS#8 or legacy PEM with DEK-Info, is decrypted by password.
+func decodeKeyPEM(data []byte, file string, password string) ([]byte, error) {
+	for rest := data; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			if len(password) == 0 {
+				return nil, fmt.Errorf("tls key_file %s is encrypted, key_password is required", file)
+			}
+			key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, fmt.Errorf("cannot decrypt tls key_file %s: %w", file, err)
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decrypt tls key_file %s: %w", file, err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		if !x509.IsEncryptedPEMBlock(block) {
+			if len(password) > 0 {
+				return nil, fmt.Errorf("tls key_password is set, but key_file %s is not encrypted", file)
+			}
+			return pem.EncodeToMemory(block), nil
+		}
+		if len(password) == 0 {
+			return nil, fmt.Errorf("tls key_file %s is encrypted, key_password is required", file)
+		}
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt tls key_file %s: %w", file, err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+	}
+	return nil, fmt.Errorf("tls key_file %s does not contain any PEM private key", file)
+}
+
+// ValidateCredential checks the credential of c. For MONGODB-X509, the client certificate must be configured,
+// the password must be empty, and the auth source must be $external.
+func ValidateCredential(c MongoConfig) error {
+	if c.Credential == nil || c.Credential.AuthMechanism == nil {
+		return nil
+	}
+	cr := c.Credential
+	if !strings.EqualFold(*cr.AuthMechanism, MechanismX509) {
+		return nil
+	}
+	if len(cr.Password) > 0 || (cr.PasswordSet != nil && *cr.PasswordSet) {
+		return errors.New("credential password must be empty for MONGODB-X509, the client certificate is used instead")
+	}
+	if cr.AuthSource != nil && len(*cr.AuthSource) > 0 && *cr.AuthSource != "$external" {
+		return fmt.Errorf("credential auth_source must be $external for MONGODB-X509, not %s", *cr.AuthSource)
+	}
+	if (c.TLS == nil || len(c.TLS.CertFile) == 0) && !strings.Contains(strings.ToLower(c.Uri), "tlscertificatekeyfile=") {
+		return errors.New("MONGODB-X509 requires a client certificate: set tls cert_file and key_file, or tlsCertificateKeyFile in the uri")
+	}
+	return nil
+}
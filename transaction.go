@@ -0,0 +1,65 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/session"
+)
+
+const (
+	TransientTransactionError      = "TransientTransactionError"
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// WithTransaction runs fn in a multi-document transaction.
+// The context passed to fn carries the session, so Writer, Inserter, Updater, MongoWriter, the batch writers,
+// BatchUpdateService and ActivityLogWriter called with it participate in the same transaction.
+// The transaction is run by mongo.Session.WithTransaction: it is retried on TransientTransactionError and the commit is retried on UnknownTransactionCommitResult,
+// so fn may be called more than once.
+// If ctx carries a session in a transaction, fn joins it and the caller keeps control of commit and abort.
+// If ctx carries a session without transaction, such as a causally consistent session, fn runs in a transaction of this session.
+func WithTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error, opts ...*options.TransactionOptions) error {
+	if s := mongo.SessionFromContext(ctx); s != nil {
+		err := runTransaction(ctx, s, fn, opts...)
+		if errors.Is(err, session.ErrTransactInProgress) {
+			// the transaction is not started, fn has not been called
+			return fn(ctx)
+		}
+		return err
+	}
+	s, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer s.EndSession(ctx)
+	return runTransaction(ctx, s, fn, opts...)
+}
+
+func runTransaction(ctx context.Context, s mongo.Session, fn func(ctx context.Context) error, opts ...*options.TransactionOptions) error {
+	_, err := s.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	}, opts...)
+	return err
+}
+
+// InTransaction returns true if ctx carries a session in a transaction, for example the context passed by WithTransaction.
+// A session without transaction returns false, because its operations are not rolled back together.
+func InTransaction(ctx context.Context) bool {
+	s, ok := mongo.SessionFromContext(ctx).(mongo.XSession)
+	return ok && s.ClientSession().TransactionRunning()
+}
+
+// hasSession returns true if ctx carries a session, in a transaction or not, which cannot be used concurrently.
+func hasSession(ctx context.Context) bool {
+	return mongo.SessionFromContext(ctx) != nil
+}
+
+func HasErrorLabel(err error, label string) bool {
+	var labeled interface{ HasErrorLabel(string) bool }
+	if errors.As(err, &labeled) {
+		return labeled.HasErrorLabel(label)
+	}
+	return false
+}
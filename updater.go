@@ -11,6 +11,8 @@ type Updater struct {
 	IdName     string
 	Map        func(ctx context.Context, model interface{}) (interface{}, error)
 	modelType  reflect.Type
+	Auditor    *Auditor
+	Retry      *RetryPolicy
 }
 
 func NewUpdaterWithId(database *mongo.Database, collectionName string, modelType reflect.Type, fieldName string, options ...func(context.Context, interface{}) (interface{}, error)) *Updater {
@@ -31,12 +33,19 @@ func NewUpdater(database *mongo.Database, collectionName string, modelType refle
 }
 
 func (w *Updater) Write(ctx context.Context, model interface{}) error {
+	return w.Retry.Do(ctx, func(ctx context.Context) error {
+		return w.write(ctx, model)
+	})
+}
+
+func (w *Updater) write(ctx context.Context, model interface{}) error {
+	w.Auditor.Update(ctx, model)
 	if w.Map != nil {
 		m2, er0 := w.Map(ctx, model)
 		if er0 != nil {
 			return er0
 		}
-		return Update(ctx, w.collection, m2, w.IdName)
+		return Update(ctx, w.collection, m2, w.IdName, w.Auditor.CreatedFields(model)...)
 	}
-	return Update(ctx, w.collection, model, w.IdName)
+	return Update(ctx, w.collection, model, w.IdName, w.Auditor.CreatedFields(model)...)
 }
@@ -0,0 +1,134 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"strings"
+	"time"
+)
+
+func equalValues(a interface{}, b interface{}) bool {
+	c, ok := compareValues(a, b)
+	return ok && c == 0
+}
+
+// compareValues compares the values of the documents and of the queries, which can be of different types, such as int and int32, or time.Time and primitive.DateTime.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	a, b = plainValue(a), plainValue(b)
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		if a == nil {
+			return -1, true
+		}
+		return 1, true
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok1 := toNumber(b); ok1 {
+			return compareFloat(x, y), true
+		}
+		return 0, false
+	}
+	if x, ok := toTime(a); ok {
+		if y, ok1 := toTime(b); ok1 {
+			return compareFloat(float64(x.UnixNano()), float64(y.UnixNano())), true
+		}
+		return 0, false
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return strings.Compare(x.Hex(), y.Hex()), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok && x == y {
+			return 0, true
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareFloat(x float64, y float64) int {
+	if x < y {
+		return -1
+	}
+	if x > y {
+		return 1
+	}
+	return 0
+}
+
+func plainValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float32:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	}
+	return toFloat(v)
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case primitive.DateTime:
+		return x.Time(), true
+	}
+	return time.Time{}, false
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch x := v.(type) {
+	case bson.M:
+		return x, true
+	case map[string]interface{}:
+		return x, true
+	case bson.D:
+		return x.Map(), true
+	}
+	return nil, false
+}
+
+func toArray(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	arr := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		arr[i] = rv.Index(i).Interface()
+	}
+	return arr
+}
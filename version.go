@@ -0,0 +1,159 @@
+package mongo
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"time"
+)
+
+// nextVersion returns the next value of a version field:
+// numbers are increased by 1, timestamps are set to now, ObjectIds and strings are regenerated.
+// The initial version is the next version of the zero value.
+func nextVersion(current reflect.Value) (reflect.Value, error) {
+	switch v := current.Interface().(type) {
+	case time.Time:
+		return reflect.ValueOf(nextTime(v)), nil
+	case *time.Time:
+		var t time.Time
+		if v != nil {
+			t = *v
+		}
+		next := nextTime(t)
+		return reflect.ValueOf(&next), nil
+	case primitive.DateTime:
+		return reflect.ValueOf(primitive.NewDateTimeFromTime(nextTime(v.Time()))), nil
+	case primitive.ObjectID:
+		return reflect.ValueOf(primitive.NewObjectID()), nil
+	}
+	next := reflect.New(current.Type()).Elem()
+	switch current.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		next.SetInt(current.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		next.SetUint(current.Uint() + 1)
+	case reflect.Float32, reflect.Float64:
+		next.SetFloat(current.Float() + 1)
+	case reflect.String:
+		next.SetString(primitive.NewObjectID().Hex())
+	default:
+		return next, fmt.Errorf("version type %s is not supported", current.Type())
+	}
+	return next, nil
+}
+
+// nextTime returns now in milliseconds, which is the precision of mongo, and is always after t.
+func nextTime(t time.Time) time.Time {
+	now := time.Now().Truncate(time.Millisecond)
+	if !now.After(t) {
+		now = t.Truncate(time.Millisecond).Add(time.Millisecond)
+	}
+	return now
+}
+
+func setDefaultVersion(model interface{}, versionIndex int) (interface{}, error) {
+	modelType := reflect.TypeOf(model).Elem()
+	if versionIndex < 0 || versionIndex >= modelType.NumField() {
+		return model, fmt.Errorf("invalid version index %d", versionIndex)
+	}
+	defaultVersion, err := nextVersion(reflect.Zero(modelType.Field(versionIndex).Type))
+	if err != nil {
+		return model, err
+	}
+	return setValue(model, versionIndex, defaultVersion.Interface())
+}
+
+func buildIdAndVersionQuery(query map[string]interface{}, model interface{}, versionIndex int) (map[string]interface{}, error) {
+	vo := reflect.Indirect(reflect.ValueOf(model))
+	if versionIndex < 0 || versionIndex >= vo.NumField() {
+		return nil, fmt.Errorf("invalid version index %d", versionIndex)
+	}
+	currentVersion := vo.Field(versionIndex)
+	next, err := nextVersion(currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	newMap := copyMap(query)
+	newMap[GetBsonNameByModelIndex(model, versionIndex)] = currentVersion.Interface()
+	currentVersion.Set(next)
+	return newMap, nil
+}
+
+// buildIdAndVersionQueryByMap adds the current version of v to query, and sets the next version to v.
+// If versionType is not nil, the version of v is converted to versionType first, because the versions of the maps decoded from JSON are strings or float64.
+func buildIdAndVersionQueryByMap(query map[string]interface{}, v map[string]interface{}, maps map[string]string, versionField string, versionType reflect.Type) (map[string]interface{}, error) {
+	newMap := copyMap(query)
+	currentVersion, exist := v[versionField]
+	if !exist {
+		return newMap, nil
+	}
+	if currentVersion == nil {
+		return nil, fmt.Errorf("version %s is nil", versionField)
+	}
+	current := reflect.ValueOf(currentVersion)
+	if versionType != nil {
+		var err error
+		if current, err = convertVersion(currentVersion, versionType); err != nil {
+			return nil, err
+		}
+	}
+	next, err := nextVersion(current)
+	if err != nil {
+		return nil, err
+	}
+	newMap[maps[versionField]] = current.Interface()
+	v[versionField] = next.Interface()
+	return newMap, nil
+}
+
+// convertVersion converts the version of a map to the type of the version field: a hex string to ObjectID, a RFC3339 string to time, and a number to another number type.
+func convertVersion(value interface{}, versionType reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if v.Type() == versionType {
+		return v, nil
+	}
+	if versionType.Kind() == reflect.Ptr {
+		elem, err := convertVersion(value, versionType.Elem())
+		if err != nil {
+			return elem, err
+		}
+		p := reflect.New(versionType.Elem())
+		p.Elem().Set(elem)
+		return p, nil
+	}
+	if s, ok := value.(string); ok {
+		switch versionType {
+		case reflect.TypeOf(primitive.ObjectID{}):
+			id, err := primitive.ObjectIDFromHex(s)
+			if err != nil {
+				return v, fmt.Errorf("invalid version %s: %w", s, err)
+			}
+			return reflect.ValueOf(id), nil
+		case reflect.TypeOf(time.Time{}), reflect.TypeOf(primitive.DateTime(0)):
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return v, fmt.Errorf("invalid version %s: %w", s, err)
+			}
+			if versionType == reflect.TypeOf(time.Time{}) {
+				return reflect.ValueOf(t), nil
+			}
+			return reflect.ValueOf(primitive.NewDateTimeFromTime(t)), nil
+		}
+	}
+	if isNumberKind(v.Kind()) && isNumberKind(versionType.Kind()) {
+		return v.Convert(versionType), nil
+	}
+	if v.Type().AssignableTo(versionType) {
+		return v, nil
+	}
+	return v, fmt.Errorf("cannot convert version %v to %s", value, versionType)
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
@@ -14,16 +14,20 @@ type Writer struct {
 	versionField string
 	versionIndex int
 	Mapper       Mapper
+	Auditor      *Auditor
 }
 
 func NewWriterWithVersion(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, versionField string, options ...Mapper) *Writer {
+	return NewWriterWithSoftDelete(db, collectionName, modelType, idObjectId, versionField, nil, options...)
+}
+func NewWriterWithSoftDelete(db *mongo.Database, collectionName string, modelType reflect.Type, idObjectId bool, versionField string, softDelete *SoftDeleteConfig, options ...Mapper) *Writer {
 	var mapper Mapper
 	var loader *Loader
 	if len(options) > 0 {
 		mapper = options[0]
-		loader = NewMongoLoader(db, collectionName, modelType, idObjectId, mapper.DbToModel)
+		loader = NewMongoLoaderWithSoftDelete(db, collectionName, modelType, idObjectId, softDelete, mapper.DbToModel)
 	} else {
-		loader = NewMongoLoader(db, collectionName, modelType, idObjectId)
+		loader = NewMongoLoaderWithSoftDelete(db, collectionName, modelType, idObjectId, softDelete)
 	}
 	if len(versionField) > 0 {
 		index := FindFieldIndex(modelType, versionField)
@@ -41,15 +45,22 @@ func NewWriter(db *mongo.Database, collectionName string, modelType reflect.Type
 }
 
 func (m *Writer) Insert(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Create(ctx, model)
 	if m.Mapper != nil {
 		m2, err := m.Mapper.ModelToDb(ctx, model)
 		if err != nil {
 			return 0, err
 		}
+		var res int64
 		if m.versionIndex >= 0 {
-			return InsertOneWithVersion(ctx, m.Collection, m2, m.versionIndex)
+			res, err = InsertOneWithVersion(ctx, m.Collection, m2, m.versionIndex)
+		} else {
+			res, err = InsertOne(ctx, m.Collection, m2)
+		}
+		if err == nil {
+			copyKeys(model, m2, m.idIndex, m.versionIndex)
 		}
-		return InsertOne(ctx, m.Collection, m2)
+		return res, err
 	}
 	if m.versionIndex >= 0 {
 		return InsertOneWithVersion(ctx, m.Collection, model, m.versionIndex)
@@ -58,25 +69,31 @@ func (m *Writer) Insert(ctx context.Context, model interface{}) (int64, error) {
 }
 
 func (m *Writer) Update(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Update(ctx, model)
 	if m.Mapper != nil {
 		m2, err := m.Mapper.ModelToDb(ctx, model)
 		if err != nil {
 			return 0, err
 		}
 		if m.versionIndex >= 0 {
-			return UpdateByIdAndVersion(ctx, m.Collection, m2, m.versionIndex)
+			res, er1 := UpdateByIdAndVersion(ctx, m.Collection, m2, m.versionIndex, m.Auditor.CreatedFields(model)...)
+			if er1 == nil {
+				copyKeys(model, m2, m.versionIndex)
+			}
+			return res, er1
 		}
 		idQuery := BuildQueryByIdFromObject(m2)
-		return UpdateOne(ctx, m.Collection, m2, idQuery)
+		return UpdateOne(ctx, m.Collection, m2, idQuery, m.Auditor.CreatedFields(model)...)
 	}
 	if m.versionIndex >= 0 {
-		return UpdateByIdAndVersion(ctx, m.Collection, model, m.versionIndex)
+		return UpdateByIdAndVersion(ctx, m.Collection, model, m.versionIndex, m.Auditor.CreatedFields(model)...)
 	}
 	idQuery := BuildQueryByIdFromObject(model)
-	return UpdateOne(ctx, m.Collection, model, idQuery)
+	return UpdateOne(ctx, m.Collection, model, idQuery, m.Auditor.CreatedFields(model)...)
 }
 
 func (m *Writer) Patch(ctx context.Context, model map[string]interface{}) (int64, error) {
+	m.Auditor.Patch(ctx, m.modelType, model, GetJsonByIndex)
 	if m.Mapper != nil {
 		m2, err := m.Mapper.ModelToDb(ctx, model)
 		if err != nil {
@@ -87,7 +104,11 @@ func (m *Writer) Patch(ctx context.Context, model map[string]interface{}) (int64
 			return 0, fmt.Errorf("result of LocationToBson must be a map[string]interface{}")
 		}
 		if m.versionIndex >= 0 {
-			return PatchByIdAndVersion(ctx, m.Collection, m3, m.maps, m.jsonIdName, m.versionField)
+			res, er1 := PatchByIdAndVersion(ctx, m.Collection, m3, m.maps, m.jsonIdName, m.versionField, m.modelType.Field(m.versionIndex).Type)
+			if er1 == nil {
+				copyMapKeys(model, m3, m.versionField)
+			}
+			return res, er1
 		}
 		jsonName0 := GetJsonByIndex(m.modelType, m.idIndex)
 		idQuery := BuildQueryByIdFromMap(m3, jsonName0)
@@ -95,7 +116,7 @@ func (m *Writer) Patch(ctx context.Context, model map[string]interface{}) (int64
 		return PatchOne(ctx, m.Collection, b0, idQuery)
 	}
 	if m.versionIndex >= 0 {
-		return PatchByIdAndVersion(ctx, m.Collection, model, m.maps, m.jsonIdName, m.versionField)
+		return PatchByIdAndVersion(ctx, m.Collection, model, m.maps, m.jsonIdName, m.versionField, m.modelType.Field(m.versionIndex).Type)
 	}
 	jsonName := GetJsonByIndex(m.modelType, m.idIndex)
 	idQuery := BuildQueryByIdFromMap(model, jsonName)
@@ -104,25 +125,77 @@ func (m *Writer) Patch(ctx context.Context, model map[string]interface{}) (int64
 }
 
 func (m *Writer) Save(ctx context.Context, model interface{}) (int64, error) {
+	m.Auditor.Save(ctx, model)
 	if m.Mapper != nil {
 		m2, err := m.Mapper.ModelToDb(ctx, model)
 		if err != nil {
 			return 0, err
 		}
+		var res int64
 		if m.versionIndex >= 0 {
-			return UpsertOneWithVersion(ctx, m.Collection, m2, m.versionIndex)
+			res, err = UpsertOneWithVersion(ctx, m.Collection, m2, m.versionIndex, m.Auditor.CreatedFields(model)...)
+		} else {
+			idQuery := BuildQueryByIdFromObject(m2)
+			res, err = UpsertOne(ctx, m.Collection, idQuery, m2, m.Auditor.CreatedFields(model)...)
 		}
-		idQuery := BuildQueryByIdFromObject(m2)
-		return UpsertOne(ctx, m.Collection, idQuery, m2)
+		if err == nil {
+			copyKeys(model, m2, m.idIndex, m.versionIndex)
+		}
+		return res, err
 	}
 	if m.versionIndex >= 0 {
-		return UpsertOneWithVersion(ctx, m.Collection, model, m.versionIndex)
+		return UpsertOneWithVersion(ctx, m.Collection, model, m.versionIndex, m.Auditor.CreatedFields(model)...)
 	}
 	idQuery := BuildQueryByIdFromObject(model)
-	return UpsertOne(ctx, m.Collection, idQuery, model)
+	return UpsertOne(ctx, m.Collection, idQuery, model, m.Auditor.CreatedFields(model)...)
 }
 
 func (m *Writer) Delete(ctx context.Context, id interface{}) (int64, error) {
 	query := bson.M{"_id": id}
+	if m.SoftDelete != nil {
+		return SoftDeleteOne(ctx, m.Collection, query, *m.SoftDelete)
+	}
 	return DeleteOne(ctx, m.Collection, query)
 }
+
+func (m *Writer) Restore(ctx context.Context, id interface{}) (int64, error) {
+	if m.SoftDelete == nil {
+		return 0, fmt.Errorf("soft delete is not configured for this writer")
+	}
+	query := bson.M{"_id": id}
+	return RestoreOne(ctx, m.Collection, query, *m.SoftDelete)
+}
+
+// Purge removes the document physically, even if soft delete is configured.
+func (m *Writer) Purge(ctx context.Context, id interface{}) (int64, error) {
+	query := bson.M{"_id": id}
+	return DeleteOne(ctx, m.Collection, query)
+}
+
+// copyKeys sets the fields at indices, such as the generated id and the next version, from the mapped model m2 to model,
+// because a mapper, such as EncryptionMapper, can return a copy of model.
+func copyKeys(model interface{}, m2 interface{}, indices ...int) {
+	dst := reflect.ValueOf(model)
+	src := reflect.ValueOf(m2)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || src.Kind() != reflect.Ptr || src.IsNil() || dst.Pointer() == src.Pointer() {
+		return
+	}
+	dst, src = dst.Elem(), src.Elem()
+	if dst.Kind() != reflect.Struct || dst.Type() != src.Type() {
+		return
+	}
+	for _, i := range indices {
+		if i >= 0 && i < dst.NumField() && dst.Field(i).CanSet() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// copyMapKeys is the same as copyKeys, for the maps of Patch.
+func copyMapKeys(model map[string]interface{}, m2 map[string]interface{}, keys ...string) {
+	for _, key := range keys {
+		if v, ok := m2[key]; ok {
+			model[key] = v
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type versionedUser struct {
+	Id      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Email   string             `json:"email" bson:"email" encrypt:"deterministic"`
+	Version int                `json:"version" bson:"version"`
+}
+
+func TestWriterWithMapperKeepsIdAndVersion(t *testing.T) {
+	keys, err := NewLocalKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelType := reflect.TypeOf(versionedUser{})
+	mapper := NewEncryptionMapper(modelType, keys)
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	mt.Run("insert and update", func(mt *mtest.T) {
+		ctx := context.Background()
+		writer := NewWriterWithVersion(mt.DB, mt.Coll.Name(), modelType, true, "Version", mapper)
+		user := &versionedUser{Email: "a@b.c"}
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if _, err := writer.Insert(ctx, user); err != nil {
+			mt.Fatal(err)
+		}
+		if user.Id.IsZero() {
+			mt.Fatal("the generated id is not set to the model")
+		}
+		if user.Version != 1 {
+			mt.Fatalf("version after insert: %d, expected 1", user.Version)
+		}
+		if user.Email != "a@b.c" {
+			mt.Fatalf("the model is encrypted: %s", user.Email)
+		}
+
+		mt.ClearEvents()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if _, err := writer.Update(ctx, user); err != nil {
+			mt.Fatal(err)
+		}
+		if user.Version != 2 {
+			mt.Fatalf("version after update: %d, expected 2", user.Version)
+		}
+		sent := mt.GetStartedEvent()
+		if sent == nil || sent.CommandName != "update" {
+			mt.Fatal("update command is not sent")
+		}
+		version := sent.Command.Lookup("updates", "0", "q", "version")
+		if v, ok := version.Int32OK(); !ok || v != 1 {
+			mt.Fatalf("update filter version: %v, expected 1", version)
+		}
+	})
+}
+
+type auditedUser struct {
+	Id        string             `json:"id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedBy string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt primitive.DateTime `json:"updatedAt" bson:"updatedAt"`
+}
+
+func TestWriterUpdateKeepsCreatedFields(t *testing.T) {
+	modelType := reflect.TypeOf(auditedUser{})
+	auditor := NewAuditor(AuditConfig{CreatedBy: "CreatedBy", CreatedAt: "CreatedAt", UpdatedAt: "UpdatedAt"})
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	mt.Run("update", func(mt *mtest.T) {
+		writer := NewWriter(mt.DB, mt.Coll.Name(), modelType)
+		writer.Auditor = auditor
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		if _, err := writer.Update(context.Background(), &auditedUser{Id: "1", Name: "a"}); err != nil {
+			mt.Fatal(err)
+		}
+		set := mt.GetStartedEvent().Command.Lookup("updates", "0", "u", "$set").Document()
+		if _, err := set.LookupErr("createdBy"); err == nil {
+			mt.Fatalf("createdBy is updated: %s", set)
+		}
+		if _, err := set.LookupErr("createdAt"); err == nil {
+			mt.Fatalf("createdAt is updated: %s", set)
+		}
+		if _, err := set.LookupErr("updatedAt"); err != nil {
+			mt.Fatalf("updatedAt is not updated: %s", set)
+		}
+	})
+
+	patch := map[string]interface{}{"id": "1", "createdBy": "x"}
+	auditor.Patch(context.Background(), modelType, patch, GetJsonByIndex)
+	if _, ok := patch["createdBy"]; ok {
+		t.Fatal("createdBy is patched")
+	}
+	if _, ok := patch["updatedAt"].(primitive.DateTime); !ok {
+		t.Fatalf("updatedAt is %T, expected primitive.DateTime", patch["updatedAt"])
+	}
+}